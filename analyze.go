@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+)
+
+const (
+	// blurHashSide is the longest side the original is reduced to before
+	// computing its BlurHash, which only keeps a few cosine components.
+	blurHashSide = 32
+	// placeholderWidth is the width of the low-quality image placeholder.
+	placeholderWidth   = 16
+	placeholderQuality = 60
+)
+
+// PhotoAnalysis is what is derived from an original besides its variants.
+type PhotoAnalysis struct {
+	BlurHash       string
+	Placeholder    string
+	PerceptualHash uint64
+}
+
+// analyzeImage computes the placeholders of an original stored in the given
+// orientation, a 4x3 component BlurHash and a tiny JPEG as a data URI small
+// enough to be inlined into listing pages, and its perceptual hash.
+func analyzeImage(img image.Image, orientation int) (PhotoAnalysis, error) {
+	small := scaleUpright(img, orientation, blurHashSide, blurHashSide, scaleToFit)
+	xComponents, yComponents := 4, 3
+	if small.Bounds().Dy() > small.Bounds().Dx() {
+		xComponents, yComponents = 3, 4
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleUpright(img, orientation, placeholderWidth, 0, scaleToFit), &jpeg.Options{Quality: placeholderQuality}); err != nil {
+		return PhotoAnalysis{}, fmt.Errorf("encoding placeholder: %w", err)
+	}
+	return PhotoAnalysis{
+		BlurHash:       blurHash(small, xComponents, yComponents),
+		Placeholder:    "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		PerceptualHash: differenceHash(scaleUpright(img, orientation, 9, 8, scaleExact)),
+	}, nil
+}
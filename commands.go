@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: image-processor [command]
+
+Without a command the gRPC server is started.
+
+commands:
+  dead-letters list                   list dead-lettered processing jobs
+  dead-letters requeue [photo-id...]  requeue dead-lettered jobs of the given photos, or of all photos
+  gc [-dry-run] [-grace d] [-prefix p]
+                                      delete bucket objects no photo or variant references and
+                                      that lost their last reference before the grace period (default 72h)
+`
+
+// runCommand runs an operator command and returns the process exit code.
+func runCommand(db *gorm.DB, args []string) int {
+	if len(args) >= 2 && args[0] == "dead-letters" {
+		switch args[1] {
+		case "list":
+			return listDeadLetters(db)
+		case "requeue":
+			return requeueDeadLetters(db, args[2:])
+		}
+	}
+	if len(args) >= 1 && args[0] == "gc" {
+		return runGarbageCollection(db, args[1:])
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+func listDeadLetters(db *gorm.DB) int {
+	jobs, err := listDeadJobs(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "PHOTO\tKIND\tVARIANT\tATTEMPTS\tUPDATED\tLAST ERROR")
+	for _, job := range jobs {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%d\t%s\t%s\n", job.IdPhoto, job.Kind, job.Variant, job.Attempts, job.UpdatedAt.Format("2006-01-02 15:04:05"), job.LastError)
+	}
+	writer.Flush()
+	return 0
+}
+
+func requeueDeadLetters(db *gorm.DB, args []string) int {
+	var photoIds []uint
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid photo id %q\n", arg)
+			return 2
+		}
+		photoIds = append(photoIds, uint(id))
+	}
+	count, err := requeueDeadJobs(db, photoIds)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("requeued %d jobs\n", count)
+	return 0
+}
+
+func runGarbageCollection(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only list the objects that would be deleted")
+	grace := flags.Duration("grace", 72*time.Hour, "keep objects unreferenced more recently")
+	prefix := flags.String("prefix", "", "only collect objects whose key starts with prefix")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	store, err := MakeObjectStore(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	action := "deleted"
+	if *dryRun {
+		action = "would delete"
+	}
+	opts := GCOptions{Prefix: *prefix, Grace: *grace, DryRun: *dryRun}
+	report, err := collectGarbage(ctx, db, store, MakeObjectUrls(store), opts, func(object ObjectInfo, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "deleting %s: %v\n", object.Key, err)
+			return
+		}
+		fmt.Printf("%s %s\t%d\t%s\n", action, object.Key, object.Size, object.Updated.Format("2006-01-02 15:04:05"))
+	})
+	fmt.Printf("scanned %d objects: %d referenced, %d within the grace period, %s %d (%d bytes), %d failed\n",
+		report.Scanned, report.Referenced, report.Recent, action, report.Deleted, report.DeletedBytes, report.Failed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
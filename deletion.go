@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// Events of the deletion audit trail. A photo's deletion is requested by an
+// RPC, every object removed from storage is recorded and the deletion is
+// completed once nothing of the photo is left in storage.
+const (
+	AuditRequested     = "requested"
+	AuditObjectDeleted = "object deleted"
+	AuditOriginalKept  = "original kept"
+	AuditCompleted     = "completed"
+)
+
+// DeletionAudit is an entry of the audit trail of photo deletions.
+type DeletionAudit struct {
+	Id        uint `gorm:"primaryKey"`
+	IdPhoto   uint `gorm:"index"`
+	IdAd      uint `gorm:"index"`
+	Event     string
+	Detail    string
+	RequestId string
+	CreatedAt time.Time
+}
+
+func (DeletionAudit) TableName() string {
+	return "t_deletion_audit"
+}
+
+func audit(db *gorm.DB, photo Photo, event string, detail string, requestId string) error {
+	return db.Create(&DeletionAudit{
+		IdPhoto:   photo.IdPhoto,
+		IdAd:      photo.IdAd,
+		Event:     event,
+		Detail:    detail,
+		RequestId: requestId,
+	}).Error
+}
+
+// deletePhotos soft-deletes the photos, drops what was derived from their
+// originals and replaces their pending jobs by a delete job, which removes
+// their objects from storage.
+func deletePhotos(ctx context.Context, tx *gorm.DB, photos []Photo, deleteOriginal bool) error {
+	for _, photo := range photos {
+		err := tx.Model(&photo).Updates(map[string]interface{}{
+			"blur_hash":       "",
+			"placeholder":     "",
+			"perceptual_hash": nil,
+			"hash_band0":      nil,
+			"hash_band1":      nil,
+			"hash_band2":      nil,
+			"hash_band3":      nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&photo).Error; err != nil {
+			return err
+		}
+		err = tx.Where("id_photo = ? AND state IN ?", photo.IdPhoto, []string{JobQueued, JobFailed}).
+			Delete(&ProcessingJob{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(&ProcessingJob{
+			IdPhoto:        photo.IdPhoto,
+			Kind:           JobKindDelete,
+			DeleteOriginal: deleteOriginal,
+			State:          JobQueued,
+			RunAt:          time.Now(),
+			RequestId:      RequestIdFromContext(ctx),
+			TraceParent:    traceParent(ctx),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := audit(tx, photo, AuditRequested, "", RequestIdFromContext(ctx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errPhotoBusy is returned by delete jobs while other jobs of the photo are
+// running. The job is postponed rather than failed, as those jobs may run
+// for as long as their lease.
+var errPhotoBusy = errors.New("photo has running jobs")
+
+// errPhotoDeleted fails resize and analyze jobs whose photo was deleted while
+// they ran. Such jobs are marked invalid, as every retry would fail as well.
+var errPhotoDeleted = fmt.Errorf("photo deleted: %w", ErrInvalidInput)
+
+// runningJobs returns the number of jobs of a photo other than except that
+// a worker is running.
+func runningJobs(db *gorm.DB, photoId uint, except uint) (int64, error) {
+	var count int64
+	err := db.Model(&ProcessingJob{}).
+		Where("id_photo = ? AND state = ? AND id <> ?", photoId, JobRunning, except).
+		Count(&count).Error
+	return count, err
+}
+
+// deleteVariant removes a variant and drops its reference to its object,
+// deleting the object when no other variant shares it. The object is deleted
+// before the transaction commits, so a failed deletion leaves the variant
+// in place for the next attempt. It reports whether the object was deleted.
+func deleteVariant(ctx context.Context, db *gorm.DB, store ObjectStore, variant PhotoVariant) (bool, error) {
+	deleted := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted = false
+		if variant.StorageKey != "" {
+			if err := releaseObject(tx, variant.StorageKey); err != nil {
+				return err
+			}
+			var object StorageObject
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", variant.StorageKey).First(&object).Error
+			if err != nil {
+				return err
+			}
+			if object.RefCount == 0 {
+				if err := store.Delete(ctx, variant.StorageKey); err != nil && !errors.Is(err, ErrObjectNotFound) {
+					return err
+				}
+				if err := tx.Delete(&object).Error; err != nil {
+					return err
+				}
+				deleted = true
+			}
+		}
+		return tx.Delete(&variant).Error
+	})
+	return deleted, err
+}
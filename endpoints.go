@@ -7,27 +7,143 @@ import (
 )
 
 type Endpoints struct {
-	ProcessEndpoint endpoint.Endpoint
+	ProcessEndpoint   endpoint.Endpoint
+	GetStatusEndpoint endpoint.Endpoint
+	WatchEndpoint     endpoint.Endpoint
+	BatchEndpoint     endpoint.Endpoint
+	SimilarEndpoint   endpoint.Endpoint
+	DeleteEndpoint    endpoint.Endpoint
+	DeleteAdEndpoint  endpoint.Endpoint
 }
 
 type ProcessRequest struct {
-	Id uint32
+	Id       uint32
+	Variants []VariantSpec
 }
 
 type ProcessResponse struct {
 	Err error
 }
 
+type GetStatusRequest struct {
+	Id uint32
+}
+
+type GetStatusResponse struct {
+	Status PhotoStatus
+	Err    error
+}
+
+type BatchRequest struct {
+	Ids      []uint32
+	IdAd     uint32
+	Variants []VariantSpec
+}
+
+type BatchResponse struct {
+	Items []BatchItem
+	Err   error
+}
+
+type SimilarRequest struct {
+	Id          uint32
+	MaxDistance int
+	Limit       int
+}
+
+type SimilarResponse struct {
+	Photos []SimilarPhoto
+	Err    error
+}
+
+type DeleteRequest struct {
+	Id             uint32
+	DeleteOriginal bool
+}
+
+type DeleteAdRequest struct {
+	IdAd           uint32
+	DeleteOriginal bool
+}
+
+type DeleteResponse struct {
+	Err error
+}
+
+// WatchRequest carries the callback the transport streams events through.
+type WatchRequest struct {
+	Id   uint32
+	Send func(VariantStatus) error
+}
+
+type WatchResponse struct {
+	Err error
+}
+
 func MakeEndpoints(logger log.Logger, service Service) Endpoints {
 	return Endpoints{
-		ProcessEndpoint: MakeProcessEndpoint(service),
+		ProcessEndpoint:   MakeProcessEndpoint(service),
+		GetStatusEndpoint: MakeGetStatusEndpoint(service),
+		WatchEndpoint:     MakeWatchEndpoint(service),
+		BatchEndpoint:     MakeBatchEndpoint(service),
+		SimilarEndpoint:   MakeSimilarEndpoint(service),
+		DeleteEndpoint:    MakeDeleteEndpoint(service),
+		DeleteAdEndpoint:  MakeDeleteAdEndpoint(service),
 	}
 }
 
 func MakeProcessEndpoint(service Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(ProcessRequest)
-		err := service.ProcessImage(ctx, req.Id)
+		err := service.ProcessImage(ctx, req.Id, req.Variants)
 		return ProcessResponse{Err: err}, nil
 	}
 }
+
+func MakeGetStatusEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(GetStatusRequest)
+		status, err := service.GetStatus(ctx, req.Id)
+		return GetStatusResponse{Status: status, Err: err}, nil
+	}
+}
+
+func MakeWatchEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(WatchRequest)
+		err := service.WatchProcessing(ctx, req.Id, req.Send)
+		return WatchResponse{Err: err}, nil
+	}
+}
+
+func MakeBatchEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BatchRequest)
+		items, err := service.ProcessBatch(ctx, req.Ids, req.IdAd, req.Variants)
+		return BatchResponse{Items: items, Err: err}, nil
+	}
+}
+
+func MakeSimilarEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SimilarRequest)
+		photos, err := service.FindSimilar(ctx, req.Id, req.MaxDistance, req.Limit)
+		return SimilarResponse{Photos: photos, Err: err}, nil
+	}
+}
+
+func MakeDeleteEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(DeleteRequest)
+		err := service.DeletePhoto(ctx, req.Id, req.DeleteOriginal)
+		return DeleteResponse{Err: err}, nil
+	}
+}
+
+func MakeDeleteAdEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(DeleteAdRequest)
+		err := service.DeleteAd(ctx, req.IdAd, req.DeleteOriginal)
+		return DeleteResponse{Err: err}, nil
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// Domain errors returned by the service. They are wrapped with context and
+// mapped to gRPC status codes by the transport.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrInvalidInput      = errors.New("invalid input")
+	ErrUnavailable       = errors.New("unavailable")
+	ErrAlreadyProcessing = errors.New("already processing")
+	ErrNotReady          = errors.New("not ready")
+)
+
+// dbError maps gorm's record not found error to ErrNotFound and any other
+// database error to ErrUnavailable.
+func dbError(err error, what string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%s: %w", what, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %v: %w", what, err, ErrUnavailable)
+}
+
+func invalidInput(err error) error {
+	return fmt.Errorf("%v: %w", err, ErrInvalidInput)
+}
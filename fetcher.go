@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenSource is returned for original URLs the fetcher refuses to
+// touch. It is invalid input, so jobs failing with it are not retried.
+var ErrForbiddenSource = fmt.Errorf("source not allowed: %w", ErrInvalidInput)
+
+// privateNetworks are the address ranges that are not reachable from the
+// internet and must not be fetched on behalf of a caller. Loopback,
+// link-local, multicast and unspecified addresses are checked separately.
+var privateNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"fc00::/7",
+)
+
+// Fetcher downloads originals. Only URLs with an allowed scheme, host and
+// bucket are fetched, and connections to private addresses are refused after
+// DNS resolution, so a photo URL can not be used to reach internal services.
+// Redirects, response size and time are capped.
+type Fetcher struct {
+	client       *http.Client
+	schemes      map[string]bool
+	hosts        []string
+	buckets      map[string]bool
+	allowPrivate bool
+	maxBytes     int64
+	download     metrics.Histogram
+}
+
+// MakeFetcher creates the fetcher configured by the SOURCE_* variables.
+// Hosts may start with "*." to allow all their subdomains. Buckets default
+// to the storage bucket. An empty host or bucket list allows any.
+func MakeFetcher(download metrics.Histogram) *Fetcher {
+	viper.AutomaticEnv()
+	viper.SetDefault("STORAGE_BUCKET", defaultBucket)
+	viper.SetDefault("SOURCE_ALLOWED_SCHEMES", "https")
+	viper.SetDefault("SOURCE_ALLOWED_HOSTS", "storage.googleapis.com,*.storage.googleapis.com")
+	viper.SetDefault("SOURCE_ALLOWED_BUCKETS", viper.GetString("STORAGE_BUCKET"))
+	viper.SetDefault("SOURCE_MAX_REDIRECTS", 3)
+	viper.SetDefault("SOURCE_MAX_BYTES", 25<<20)
+	viper.SetDefault("SOURCE_TIMEOUT", "30s")
+
+	fetcher := &Fetcher{
+		schemes:      map[string]bool{},
+		hosts:        splitList(viper.GetString("SOURCE_ALLOWED_HOSTS")),
+		buckets:      map[string]bool{},
+		allowPrivate: viper.GetBool("SOURCE_ALLOW_PRIVATE_NETWORKS"),
+		maxBytes:     viper.GetInt64("SOURCE_MAX_BYTES"),
+		download:     download.With("source", "original"),
+	}
+	for _, scheme := range splitList(viper.GetString("SOURCE_ALLOWED_SCHEMES")) {
+		fetcher.schemes[strings.ToLower(scheme)] = true
+	}
+	for _, bucket := range splitList(viper.GetString("SOURCE_ALLOWED_BUCKETS")) {
+		fetcher.buckets[bucket] = true
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: fetcher.checkDial,
+	}
+	maxRedirects := viper.GetInt("SOURCE_MAX_REDIRECTS")
+	fetcher.client = &http.Client{
+		// No proxy: the dialer has to see the address it connects to.
+		Transport: otelhttp.NewTransport(&http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		}),
+		Timeout: viper.GetDuration("SOURCE_TIMEOUT"),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("more than %d redirects: %w", maxRedirects, ErrForbiddenSource)
+			}
+			return fetcher.checkUrl(req.URL)
+		},
+	}
+	return fetcher
+}
+
+// Fetch downloads rawUrl, which must be allowed, and returns its body.
+func (fetcher *Fetcher) Fetch(ctx context.Context, rawUrl string) ([]byte, error) {
+	defer func(begin time.Time) { fetcher.download.Observe(time.Since(begin).Seconds()) }(time.Now())
+	if _, err := fetcher.parse(rawUrl); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fetcher.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Received non 200 response code: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > fetcher.maxBytes {
+		return nil, fmt.Errorf("original is %d bytes, more than %d: %w", resp.ContentLength, fetcher.maxBytes, ErrInvalidImage)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, fetcher.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > fetcher.maxBytes {
+		return nil, fmt.Errorf("original is more than %d bytes: %w", fetcher.maxBytes, ErrInvalidImage)
+	}
+	return data, nil
+}
+
+func (fetcher *Fetcher) parse(rawUrl string) (*url.URL, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrForbiddenSource)
+	}
+	return u, fetcher.checkUrl(u)
+}
+
+// checkUrl checks the scheme, host and bucket of u against the allow lists.
+func (fetcher *Fetcher) checkUrl(u *url.URL) error {
+	if !fetcher.schemes[strings.ToLower(u.Scheme)] {
+		return fmt.Errorf("scheme %q: %w", u.Scheme, ErrForbiddenSource)
+	}
+	if u.User != nil {
+		return fmt.Errorf("credentials in URL: %w", ErrForbiddenSource)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("URL has no host: %w", ErrForbiddenSource)
+	}
+	bucket, ok := fetcher.matchHost(host, u.Path)
+	if !ok {
+		return fmt.Errorf("host %q: %w", host, ErrForbiddenSource)
+	}
+	if len(fetcher.buckets) > 0 && !fetcher.buckets[bucket] {
+		return fmt.Errorf("bucket %q: %w", bucket, ErrForbiddenSource)
+	}
+	return nil
+}
+
+// matchHost reports whether host is allowed and returns the bucket the URL
+// refers to: the subdomain for hosts matched by a "*." pattern, as in
+// <bucket>.storage.googleapis.com, and the first path segment otherwise.
+func (fetcher *Fetcher) matchHost(host string, path string) (string, bool) {
+	pathBucket := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	if len(fetcher.hosts) == 0 {
+		return pathBucket, true
+	}
+	for _, allowed := range fetcher.hosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return pathBucket, true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) && len(host) > len(allowed)-1 {
+			return strings.TrimSuffix(host, allowed[1:]), true
+		}
+	}
+	return "", false
+}
+
+// checkDial is the dialer's Control hook. It runs with the resolved address
+// right before connecting, so DNS answers pointing at internal addresses are
+// caught as well.
+func (fetcher *Fetcher) checkDial(network string, address string, _ syscall.RawConn) error {
+	if fetcher.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	return checkIP(net.ParseIP(host))
+}
+
+func checkIP(ip net.IP) error {
+	if ip == nil {
+		return fmt.Errorf("invalid address: %w", ErrForbiddenSource)
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("address %s: %w", ip, ErrForbiddenSource)
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("private address %s: %w", ip, ErrForbiddenSource)
+		}
+	}
+	return nil
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// splitList splits a comma separated configuration value, dropping empty
+// entries.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// localStore keeps objects in a directory and serves them over HTTP, so the
+// pipeline can run on a developer machine without any cloud credentials.
+type localStore struct {
+	dir       string
+	publicUrl string
+	files     http.Handler
+}
+
+func NewLocalStore(dir string, publicUrl string) (ObjectStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &localStore{
+		dir:       dir,
+		publicUrl: strings.TrimSuffix(publicUrl, "/"),
+		files:     http.FileServer(http.Dir(dir)),
+	}, nil
+}
+
+// path maps an object key to a file below the store directory; keys can not
+// escape it.
+func (store localStore) path(key string) string {
+	return filepath.Join(store.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put writes the object atomically. The local store keeps no object
+// metadata: content types are derived from the key's extension when serving
+// and opts.CacheControl is ignored.
+func (store localStore) Put(ctx context.Context, key string, reader io.Reader, opts PutOptions) error {
+	name := store.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(name), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+func (store localStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(store.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return file, err
+}
+
+func (store localStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(store.path(key))
+	if os.IsNotExist(err) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+func (store localStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := os.Stat(store.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		Updated:     info.ModTime(),
+	}, nil
+}
+
+func (store localStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	return filepath.Walk(store.dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(store.dir, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(ObjectInfo{
+			Key:         key,
+			Size:        info.Size(),
+			ContentType: mime.TypeByExtension(filepath.Ext(key)),
+			Updated:     info.ModTime(),
+		})
+	})
+}
+
+func (store localStore) URL(key string) string {
+	return store.publicUrl + "/" + key
+}
+
+func (store localStore) Close() error {
+	return nil
+}
+
+// ServeHTTP serves the stored objects under their keys.
+func (store localStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	store.files.ServeHTTP(w, r)
+}
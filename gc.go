@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// gcBatchSize is the number of listed objects looked up in the database at
+// once. Photos are looked up by up to eight URLs per object in four columns,
+// which stays below the 65535 parameters of a Postgres query.
+const gcBatchSize = 1000
+
+var (
+	errObjectReferenced = errors.New("object is referenced")
+	errObjectRecent     = errors.New("object was referenced recently")
+)
+
+// GCOptions select what the garbage collector deletes. Objects that lost
+// their last reference within Grace are kept, as a worker may still be about
+// to save a variant of them; objects whose references were never counted
+// are kept while they were stored within Grace.
+type GCOptions struct {
+	Prefix string
+	Grace  time.Duration
+	DryRun bool
+}
+
+// GCReport summarizes a garbage collection run. In a dry run Deleted counts
+// the objects that would have been deleted.
+type GCReport struct {
+	Scanned      int
+	Referenced   int
+	Recent       int
+	Deleted      int
+	DeletedBytes int64
+	Failed       int
+}
+
+// collectGarbage lists the objects of the store and deletes those that are
+// neither referenced by a variant, a counted reference nor a URL column of
+// t_photo, originals included. deleted is called for every object deleted,
+// or that would be deleted in a dry run, with the error deleting it.
+//
+// Only references of variants stored under content addressed keys are
+// counted, other objects depend on the URLs of t_photo being understood by
+// urls. Scheduled runs should be limited to variantPrefix.
+//
+// Workers reference an object before looking for it, so an object they
+// found and skipped uploading is counted by the time it is locked here.
+func collectGarbage(ctx context.Context, db *gorm.DB, store ObjectStore, urls ObjectUrls, opts GCOptions, deleted func(ObjectInfo, error)) (GCReport, error) {
+	var report GCReport
+	cutoff := time.Now().Add(-opts.Grace)
+	var batch []ObjectInfo
+	collect := func() error {
+		referenced, unreferencedAt, err := referencedObjects(db.WithContext(ctx), batch)
+		if err != nil {
+			return err
+		}
+		photoKeys, err := photoReferences(db.WithContext(ctx), urls, batch)
+		if err != nil {
+			return err
+		}
+		for _, object := range batch {
+			if referenced[object.Key] || photoKeys[object.Key] {
+				report.Referenced++
+				continue
+			}
+			since, counted := unreferencedAt[object.Key]
+			if !counted {
+				since = object.Updated
+			}
+			if since.After(cutoff) {
+				report.Recent++
+				continue
+			}
+			if !opts.DryRun {
+				err = deleteObject(ctx, db, store, object.Key, cutoff)
+				if errors.Is(err, errObjectReferenced) {
+					report.Referenced++
+					continue
+				}
+				if errors.Is(err, errObjectRecent) {
+					report.Recent++
+					continue
+				}
+				if err != nil {
+					report.Failed++
+					deleted(object, err)
+					continue
+				}
+			}
+			report.Deleted++
+			report.DeletedBytes += object.Size
+			deleted(object, nil)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := store.List(ctx, opts.Prefix, func(object ObjectInfo) error {
+		report.Scanned++
+		batch = append(batch, object)
+		if len(batch) < gcBatchSize {
+			return nil
+		}
+		return collect()
+	})
+	if err == nil && len(batch) > 0 {
+		err = collect()
+	}
+	return report, err
+}
+
+// photoReferences returns which of the objects the URL columns of t_photo
+// refer to, deleted photos included, as they keep their original unless it
+// was deleted with them. The URLs were saved in several forms over time, all
+// of them are looked up and parsed back.
+func photoReferences(db *gorm.DB, urls ObjectUrls, objects []ObjectInfo) (map[string]bool, error) {
+	listed := map[string]bool{}
+	var candidates []string
+	for _, object := range objects {
+		listed[object.Key] = true
+		candidates = append(candidates, urls.Urls(object.Key)...)
+	}
+
+	var photos []Photo
+	err := db.Unscoped().Select("id_photo", "url_original", "url_small", "url_medium", "url_large").
+		Where("url_original IN ? OR url_small IN ? OR url_medium IN ? OR url_large IN ?", candidates, candidates, candidates, candidates).
+		Find(&photos).Error
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	for _, photo := range photos {
+		for _, url := range []string{photo.UrlOriginal, photo.UrlSmall, photo.UrlMedium, photo.UrlLarge} {
+			if key, ok := urls.Key(url); ok && listed[key] {
+				referenced[key] = true
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// referencedObjects returns which of the objects are referenced by a
+// variant or a counted reference, and since when the counted objects without
+// references are unreferenced.
+func referencedObjects(db *gorm.DB, objects []ObjectInfo) (map[string]bool, map[string]time.Time, error) {
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+
+	referenced := map[string]bool{}
+	var variantKeys []string
+	if err := db.Model(&PhotoVariant{}).Where("storage_key IN ?", keys).Pluck("storage_key", &variantKeys).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, key := range variantKeys {
+		referenced[key] = true
+	}
+	var counted []StorageObject
+	if err := db.Where("key IN ?", keys).Find(&counted).Error; err != nil {
+		return nil, nil, err
+	}
+	unreferencedAt := map[string]time.Time{}
+	for _, object := range counted {
+		if object.RefCount > 0 {
+			referenced[object.Key] = true
+		} else {
+			unreferencedAt[object.Key] = unreferencedSince(object)
+		}
+	}
+	return referenced, unreferencedAt, nil
+}
+
+// unreferencedSince returns when a counted object without references lost
+// its last one.
+func unreferencedSince(object StorageObject) time.Time {
+	if object.UnreferencedAt != nil {
+		return *object.UnreferencedAt
+	}
+	return object.UpdatedAt
+}
+
+// deleteObject deletes an unreferenced object and its reference count. The
+// count is locked and checked again, so objects that gained a reference since
+// they were looked up, or lost one after cutoff, are kept.
+func deleteObject(ctx context.Context, db *gorm.DB, store ObjectStore, key string, cutoff time.Time) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var objects []StorageObject
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).Find(&objects).Error; err != nil {
+			return err
+		}
+		if len(objects) > 0 && objects[0].RefCount > 0 {
+			return errObjectReferenced
+		}
+		if len(objects) > 0 && unreferencedSince(objects[0]).After(cutoff) {
+			return errObjectRecent
+		}
+		if err := store.Delete(ctx, key); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			return err
+		}
+		return tx.Where("key = ?", key).Delete(&StorageObject{}).Error
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"io"
+	"strings"
+)
+
+type gcsStore struct {
+	client    *storage.Client
+	bucket    *storage.BucketHandle
+	publicUrl string
+}
+
+func NewGCSStore(ctx context.Context, credentialsJSON []byte, bucket string, publicUrl string) (ObjectStore, error) {
+	client, err := storage.NewClient(ctx, option.WithCredentialsJSON(credentialsJSON))
+	if err != nil {
+		return nil, err
+	}
+	if publicUrl == "" {
+		publicUrl = fmt.Sprintf("https://storage.googleapis.com/%s", bucket)
+	}
+	return &gcsStore{
+		client:    client,
+		bucket:    client.Bucket(bucket),
+		publicUrl: strings.TrimSuffix(publicUrl, "/"),
+	}, nil
+}
+
+func (store gcsStore) Put(ctx context.Context, key string, reader io.Reader, opts PutOptions) error {
+	writer := store.bucket.Object(key).NewWriter(ctx)
+	writer.ContentType = opts.ContentType
+	writer.CacheControl = opts.CacheControl
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (store gcsStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := store.bucket.Object(key).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrObjectNotFound
+	}
+	return reader, err
+}
+
+func (store gcsStore) Delete(ctx context.Context, key string) error {
+	err := store.bucket.Object(key).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+func (store gcsStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	attrs, err := store.bucket.Object(key).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Updated:     attrs.Updated,
+	}, nil
+}
+
+func (store gcsStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	objects := store.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(ObjectInfo{
+			Key:         attrs.Name,
+			Size:        attrs.Size,
+			ContentType: attrs.ContentType,
+			Updated:     attrs.Updated,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (store gcsStore) URL(key string) string {
+	return store.publicUrl + "/" + key
+}
+
+func (store gcsStore) Close() error {
+	return store.client.Close()
+}
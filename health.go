@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"gorm.io/gorm"
+	"time"
+)
+
+// grpcServiceName is the name the ImageProcessorService is registered under,
+// and so the service name its readiness is reported for.
+const grpcServiceName = "ImageProcessorService"
+
+// healthProbeKey is stat'ed to check that the object store is reachable. It
+// does not need to exist.
+const healthProbeKey = ".health"
+
+// HealthChecker periodically checks the dependencies of the service and
+// publishes the result through the standard grpc.health.v1 service.
+//
+// The overall status (service "") is the liveness of the process: it is only
+// NOT_SERVING when the worker pool stopped making progress, which a restart
+// fixes. The status of the ImageProcessorService is its readiness and also
+// requires Postgres and the object store to be reachable.
+type HealthChecker struct {
+	logger   log.Logger
+	server   *health.Server
+	db       *gorm.DB
+	store    ObjectStore
+	workers  *WorkerPool
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func MakeHealthChecker(logger log.Logger, db *gorm.DB, store ObjectStore, workers *WorkerPool, interval time.Duration) *HealthChecker {
+	server := health.NewServer()
+	server.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	server.SetServingStatus(grpcServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	return &HealthChecker{
+		logger:   log.With(logger, "component", "health"),
+		server:   server,
+		db:       db,
+		store:    store,
+		workers:  workers,
+		interval: interval,
+		timeout:  interval / 2,
+	}
+}
+
+// Server returns the grpc.health.v1 implementation to register.
+func (checker *HealthChecker) Server() healthpb.HealthServer {
+	return checker.server
+}
+
+// Run checks the dependencies every interval until ctx is cancelled. All
+// services are reported NOT_SERVING once it returns.
+func (checker *HealthChecker) Run(ctx context.Context) {
+	for {
+		checker.check(ctx)
+		select {
+		case <-ctx.Done():
+			checker.server.Shutdown()
+			return
+		case <-time.After(checker.interval):
+		}
+	}
+}
+
+func (checker *HealthChecker) check(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, checker.timeout)
+	defer cancel()
+
+	live := checker.workers.Healthy()
+	ready := live
+	if ready == nil {
+		ready = checker.checkDatabase(ctx)
+	}
+	if ready == nil {
+		ready = checker.checkStore(ctx)
+	}
+
+	checker.server.SetServingStatus("", servingStatus(live))
+	checker.server.SetServingStatus(grpcServiceName, servingStatus(ready))
+	if ready != nil && parent.Err() == nil {
+		level.Warn(checker.logger).Log("context", "health check", "msg", ready)
+	}
+}
+
+func (checker *HealthChecker) checkDatabase(ctx context.Context) error {
+	sqlDB, err := checker.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	return nil
+}
+
+func (checker *HealthChecker) checkStore(ctx context.Context) error {
+	_, err := checker.store.Stat(ctx, healthProbeKey)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("object store: %w", err)
+	}
+	return nil
+}
+
+func servingStatus(err error) healthpb.HealthCheckResponse_ServingStatus {
+	if err != nil {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type imageresizerResizer struct {
+	apiKey   string
+	download metrics.Histogram
+}
+
+func NewImageresizerResizer(apiKey string, download metrics.Histogram) Resizer {
+	return &imageresizerResizer{
+		apiKey:   apiKey,
+		download: download.With("source", "imageresizer"),
+	}
+}
+
+func (resizer imageresizerResizer) Name() string {
+	return "imageresizer"
+}
+
+func (resizer imageresizerResizer) Formats() []string {
+	return nil
+}
+
+// Resize registers the original with imageresizer.io and downloads the
+// resized variant from im.ages.io, so that it can be sanitized and stored
+// like the other backends' output. Only FitContain in the original format is
+// supported, and only for originals that need no EXIF rotation, which
+// imageresizer does not apply.
+func (resizer imageresizerResizer) Resize(ctx context.Context, source ResizeSource, spec ResizeSpec) (*ResizeResult, error) {
+	if source.Url == "" {
+		return nil, fmt.Errorf("imageresizer needs a source URL")
+	}
+	if spec.Fit != FitContain || spec.Format != FormatOriginal || source.Orientation > 1 {
+		return nil, ErrUnsupportedSpec
+	}
+
+	apiUrl := fmt.Sprintf("https://api.imageresizer.io/v1/images?key=%s&url=%s",
+		resizer.apiKey,
+		url.QueryEscape(source.Url))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	setRequestIdHeader(req)
+	response, err := tracedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("imageresizer API call: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("imageresizer API call: Received non 200 response code: %d", response.StatusCode)
+	}
+
+	var res map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&res)
+	imageresizerResponse, ok := res["response"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("imageresizer API call: unexpected response")
+	}
+	id, ok := imageresizerResponse["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("imageresizer API call: no image id in response")
+	}
+
+	query := url.Values{}
+	if spec.Width != 0 {
+		query.Set("width", fmt.Sprint(spec.Width))
+	}
+	if spec.Height != 0 {
+		query.Set("height", fmt.Sprint(spec.Height))
+	}
+	if spec.Quality != 0 {
+		query.Set("quality", fmt.Sprint(spec.Quality))
+	}
+
+	defer func(begin time.Time) { resizer.download.Observe(time.Since(begin).Seconds()) }(time.Now())
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "https://im.ages.io/"+id+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err = tracedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("im.ages.io image download: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("im.ages.io image download: Received non 200 response code: %d", response.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("im.ages.io image download: %w", err)
+	}
+	return &ResizeResult{
+		Data:        data,
+		ContentType: response.Header.Get("Content-Type"),
+		Backend:     resizer.Name(),
+	}, nil
+}
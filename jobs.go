@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/rand"
+	"time"
+)
+
+// A job is queued until a worker claims it. Failed jobs wait for their next
+// attempt at RunAt, and jobs that ran out of attempts are dead-lettered
+// until an operator requeues them. Jobs whose original was rejected are
+// invalid for good.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobDead      = "dead"
+	JobInvalid   = "invalid"
+)
+
+// Resize jobs produce a variant of a photo, analyze jobs compute what is
+// derived from the original itself, such as its placeholders. Delete jobs
+// remove the objects of a deleted photo from storage.
+const (
+	JobKindResize  = "resize"
+	JobKindAnalyze = "analyze"
+	JobKindDelete  = "delete"
+)
+
+// ProcessingJob is a single variant of a photo waiting to be resized, the
+// analysis of its original or the deletion of its objects, which includes
+// the original if DeleteOriginal is set. Custom variants differ from the
+// server-side preset of their name, so their URLs are not written to the
+// legacy columns. Jobs live in Postgres, so they survive restarts and are
+// shared by all replicas.
+type ProcessingJob struct {
+	Id             uint   `gorm:"primaryKey"`
+	IdPhoto        uint   `gorm:"index"`
+	Kind           string `gorm:"default:resize"`
+	Variant        string
+	Width          int
+	Height         int
+	Fit            string
+	Format         string
+	Quality        int
+	Custom         bool
+	DeleteOriginal bool
+	State          string `gorm:"index"`
+	Attempts       int
+	LastError      string
+	RunAt          time.Time `gorm:"index"`
+	LockedUntil    time.Time
+	RequestId      string
+	TraceParent    string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (ProcessingJob) TableName() string {
+	return "processing_job"
+}
+
+// RetryPolicy controls how often and when failed jobs are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// delay returns the exponential backoff before the attempt following the
+// given one, with the upper half of it jittered so that jobs which failed
+// together do not retry together.
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < attempt && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// claimJob locks the oldest runnable job and marks it as running until
+// lease expires. Running jobs whose lease expired belong to a worker that
+// died and are claimed again, unless they ran out of attempts: a job that
+// kills its worker would otherwise take down every replica in turn, so it is
+// dead-lettered instead. It returns gorm.ErrRecordNotFound when there is
+// nothing to do.
+func claimJob(ctx context.Context, db *gorm.DB, lease time.Duration, policy RetryPolicy) (ProcessingJob, error) {
+	var job ProcessingJob
+	found := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		for {
+			job = ProcessingJob{}
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("(state IN ? AND run_at <= ?) OR (state = ? AND locked_until < ?)", []string{JobQueued, JobFailed}, now, JobRunning, now).
+				Order("id").
+				First(&job).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Commits the jobs dead-lettered so far.
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if job.State != JobRunning || job.Attempts < policy.MaxAttempts {
+				break
+			}
+			err = tx.Model(&job).Updates(map[string]interface{}{
+				"state":      JobDead,
+				"last_error": fmt.Sprintf("worker lost: lease expired on attempt %d", job.Attempts),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		found = true
+		job.State = JobRunning
+		job.Attempts++
+		job.LockedUntil = now.Add(lease)
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"state":        job.State,
+			"attempts":     job.Attempts,
+			"locked_until": job.LockedUntil,
+		}).Error
+	})
+	if err == nil && !found {
+		err = gorm.ErrRecordNotFound
+	}
+	return job, err
+}
+
+// finishJob records the outcome of a claimed job. Failed jobs are scheduled
+// for another attempt according to policy or dead-lettered when they ran out
+// of attempts. Jobs failing on invalid input are marked invalid right away,
+// as retrying them can not help.
+func finishJob(db *gorm.DB, job ProcessingJob, jobErr error, policy RetryPolicy) error {
+	updates := map[string]interface{}{
+		"state":      JobSucceeded,
+		"last_error": "",
+	}
+	if jobErr != nil {
+		updates["last_error"] = jobErr.Error()
+		switch {
+		case errors.Is(jobErr, ErrInvalidInput):
+			updates["state"] = JobInvalid
+		case job.Attempts < policy.MaxAttempts:
+			updates["state"] = JobFailed
+			updates["run_at"] = time.Now().Add(policy.delay(job.Attempts))
+		default:
+			updates["state"] = JobDead
+		}
+	}
+	return updateClaimed(db, job, updates)
+}
+
+// errLeaseLost is returned when a job's outcome is recorded after its lease
+// expired and another worker claimed it.
+var errLeaseLost = errors.New("lease lost to another worker")
+
+// updateClaimed updates a job that is still claimed by the attempt job was
+// read at.
+func updateClaimed(db *gorm.DB, job ProcessingJob, updates map[string]interface{}) error {
+	result := db.Model(&ProcessingJob{}).
+		Where("id = ? AND state = ? AND attempts = ?", job.Id, JobRunning, job.Attempts).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("job %d attempt %d: %w", job.Id, job.Attempts, errLeaseLost)
+	}
+	return nil
+}
+
+// releaseJob puts a claimed job that was interrupted before it finished back
+// into the queue. The interrupted attempt is not counted.
+func releaseJob(db *gorm.DB, job ProcessingJob) error {
+	return postponeJob(db, job, 0)
+}
+
+// postponeJob puts a claimed job that could not start yet back into the
+// queue to run after delay, without counting the attempt.
+func postponeJob(db *gorm.DB, job ProcessingJob, delay time.Duration) error {
+	return updateClaimed(db, job, map[string]interface{}{
+		"state":    JobQueued,
+		"attempts": job.Attempts - 1,
+		"run_at":   time.Now().Add(delay),
+	})
+}
+
+// inFlightPhotos returns which of the given photos have resize jobs that did
+// not reach a terminal state yet. Analyze jobs are left out, as the status of
+// a photo only reports its variants; analyzing again is harmless.
+func inFlightPhotos(db *gorm.DB, photoIds []uint) (map[uint]bool, error) {
+	inFlight := map[uint]bool{}
+	if len(photoIds) == 0 {
+		return inFlight, nil
+	}
+	var ids []uint
+	err := db.Model(&ProcessingJob{}).
+		Distinct("id_photo").
+		Where("id_photo IN ? AND kind = ? AND state IN ?", photoIds, JobKindResize, []string{JobQueued, JobRunning, JobFailed}).
+		Pluck("id_photo", &ids).Error
+	for _, id := range ids {
+		inFlight[id] = true
+	}
+	return inFlight, err
+}
+
+// countJobs returns the number of jobs per state.
+func countJobs(db *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		State string
+		Count int64
+	}
+	err := db.Model(&ProcessingJob{}).
+		Select("state, COUNT(*) AS count").
+		Where("state <> ?", JobSucceeded).
+		Group("state").
+		Scan(&rows).Error
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[row.State] = row.Count
+	}
+	return counts, err
+}
+
+// latestJobs returns the most recent resize job of every variant of a photo.
+func latestJobs(db *gorm.DB, photoId uint) ([]ProcessingJob, error) {
+	var jobs []ProcessingJob
+	err := db.Where("id IN (?)", db.Model(&ProcessingJob{}).
+		Select("MAX(id)").
+		Where("id_photo = ? AND kind = ?", photoId, JobKindResize).
+		Group("variant")).
+		Order("id").
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// listDeadJobs returns all dead-lettered jobs, oldest first.
+func listDeadJobs(db *gorm.DB) ([]ProcessingJob, error) {
+	var jobs []ProcessingJob
+	err := db.Where("state = ?", JobDead).Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+// requeueDeadJobs puts the dead-lettered jobs of the given photos, or of all
+// photos when none are given, back into the queue with fresh attempts.
+func requeueDeadJobs(db *gorm.DB, photoIds []uint) (int64, error) {
+	query := db.Model(&ProcessingJob{}).Where("state = ?", JobDead)
+	if len(photoIds) > 0 {
+		query = query.Where("id_photo IN ?", photoIds)
+	}
+	result := query.Updates(map[string]interface{}{
+		"state":    JobQueued,
+		"attempts": 0,
+		"run_at":   time.Now(),
+	})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type krakenResizer struct {
+	apiKey    string
+	apiSecret string
+	download  metrics.Histogram
+}
+
+func NewKrakenResizer(apiKey string, apiSecret string, download metrics.Histogram) Resizer {
+	return &krakenResizer{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		download:  download.With("source", "kraken"),
+	}
+}
+
+func (resizer krakenResizer) Name() string {
+	return "kraken"
+}
+
+func (resizer krakenResizer) Formats() []string {
+	return []string{FormatJpeg, FormatPng, FormatWebp}
+}
+
+func (resizer krakenResizer) Resize(ctx context.Context, source ResizeSource, spec ResizeSpec) (*ResizeResult, error) {
+	if source.Url == "" {
+		return nil, fmt.Errorf("kraken.io needs a source URL")
+	}
+	if spec.Format == FormatAvif {
+		return nil, ErrUnsupportedSpec
+	}
+
+	resize := map[string]interface{}{
+		"width":    spec.Width,
+		"height":   spec.Height,
+		"strategy": krakenStrategy(spec),
+		"enhance":  true,
+	}
+	request := map[string]interface{}{
+		"auth": map[string]interface{}{
+			"api_key":    resizer.apiKey,
+			"api_secret": resizer.apiSecret,
+		},
+		"url":         source.Url,
+		"resize":      resize,
+		"wait":        true,
+		"auto_orient": true,
+	}
+	if spec.Format != FormatOriginal {
+		request["convert"] = map[string]interface{}{"format": spec.Format}
+	}
+	if spec.Quality != 0 {
+		request["lossy"] = true
+		request["quality"] = spec.Quality
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.kraken.io/v1/url", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	setRequestIdHeader(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tracedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kraken.io API call: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var res map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&res)
+	krakedUrl, ok := res["kraked_url"].(string)
+	if !ok {
+		return nil, fmt.Errorf("kraken.io API call: no kraked_url in response: %v", res["message"])
+	}
+
+	defer func(begin time.Time) { resizer.download.Observe(time.Since(begin).Seconds()) }(time.Now())
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, krakedUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := tracedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kraken.io image download: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("kraken.io image download: Received non 200 response code: %d", response.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("kraken.io image download: %w", err)
+	}
+	return &ResizeResult{
+		Data:        data,
+		ContentType: response.Header.Get("Content-Type"),
+		Backend:     resizer.Name(),
+	}, nil
+}
+
+// krakenStrategy maps the fit mode to a kraken.io resize strategy.
+func krakenStrategy(spec ResizeSpec) string {
+	switch {
+	case spec.Fit == FitCover:
+		return "fit"
+	case spec.Fit == FitExact:
+		return "exact"
+	case spec.Height == 0:
+		return "landscape"
+	case spec.Width == 0:
+		return "portrait"
+	default:
+		return "auto"
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golang.org/x/image/draw"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const jpegQuality = 85
+
+// localResizer resizes images in-process, so it needs no third-party API and
+// works as the last resort of the chain or as the only backend.
+type localResizer struct {
+	fetcher *Fetcher
+}
+
+func NewLocalResizer(fetcher *Fetcher) Resizer {
+	return &localResizer{fetcher: fetcher}
+}
+
+func (resizer localResizer) Name() string {
+	return "local"
+}
+
+func (resizer localResizer) Formats() []string {
+	return []string{FormatJpeg, FormatPng}
+}
+
+// Resize decodes the original, unless the source carries it decoded, scales
+// it according to the spec's fit mode, turns it upright according to its
+// EXIF orientation and re-encodes it. Unless the spec asks for a format, JPEG
+// sources stay JPEG and PNG and GIF sources are encoded as PNG.
+func (resizer localResizer) Resize(ctx context.Context, source ResizeSource, spec ResizeSpec) (*ResizeResult, error) {
+	if spec.Format != FormatOriginal && spec.Format != FormatJpeg && spec.Format != FormatPng {
+		return nil, ErrUnsupportedSpec
+	}
+	data := source.Data
+	if data == nil {
+		var err error
+		if data, err = resizer.fetcher.Fetch(ctx, source.Url); err != nil {
+			return nil, fmt.Errorf("original download: %w", err)
+		}
+	}
+
+	src := source.Image
+	var format string
+	var err error
+	if src != nil {
+		_, format, err = image.DecodeConfig(bytes.NewReader(data))
+	} else {
+		src, format, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding original: %v: %w", err, ErrInvalidImage)
+	}
+	fit := scaleToFit
+	switch spec.Fit {
+	case FitCover:
+		fit = scaleToCover
+	case FitExact:
+		fit = scaleExact
+	}
+	dst := scaleUpright(src, source.Orientation, spec.Width, spec.Height, fit)
+
+	result := &ResizeResult{
+		Width:   dst.Bounds().Dx(),
+		Height:  dst.Bounds().Dy(),
+		Backend: resizer.Name(),
+	}
+	if spec.Format != FormatOriginal {
+		format = spec.Format
+	}
+	var buf bytes.Buffer
+	if format == FormatJpeg {
+		quality := spec.Quality
+		if quality == 0 {
+			quality = jpegQuality
+		}
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+		result.ContentType = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, dst)
+		result.ContentType = "image/png"
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encoding variant: %w", err)
+	}
+	result.Data = buf.Bytes()
+	return result, nil
+}
+
+// scaleUpright scales src, whose pixels are stored in the given EXIF
+// orientation, with fit into a width x height box of the upright image and
+// turns the result upright. Orienting the scaled result instead of the
+// original saves copying the original's pixels twice.
+func scaleUpright(src image.Image, orientation int, width int, height int, fit func(image.Image, int, int) image.Image) image.Image {
+	// Orientations 5 to 8 are transposed, the box is too before orienting.
+	if orientation >= 5 && orientation <= 8 {
+		width, height = height, width
+	}
+	return orient(fit(src, width, height), orientation)
+}
+
+// scaleExact scales src to width x height, ignoring its aspect ratio.
+func scaleExact(src image.Image, width int, height int) image.Image {
+	return scale(src, src.Bounds(), width, height)
+}
+
+// scaleToFit scales src so that it fits into a width x height box while
+// keeping its aspect ratio. A zero width or height leaves that side
+// unconstrained. Images that already fit are returned unchanged.
+func scaleToFit(src image.Image, width int, height int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if width == 0 {
+		width = w
+	}
+	if height == 0 {
+		height = h
+	}
+	if w <= width && h <= height {
+		return src
+	}
+	if w*height > h*width {
+		h = h * width / w
+		w = width
+	} else {
+		w = w * height / h
+		h = height
+	}
+	return scale(src, bounds, w, h)
+}
+
+// scaleToCover fills the whole width x height box, cropping the centre of
+// src to the box's aspect ratio.
+func scaleToCover(src image.Image, width int, height int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	crop := bounds
+	if w*height > h*width {
+		cw := h * width / height
+		crop.Min.X += (w - cw) / 2
+		crop.Max.X = crop.Min.X + cw
+	} else {
+		ch := w * height / width
+		crop.Min.Y += (h - ch) / 2
+		crop.Max.Y = crop.Min.Y + ch
+	}
+	return scale(src, crop, width, height)
+}
+
+// scale scales the part r of src to a width x height image with a
+// Catmull-Rom filter.
+func scale(src image.Image, r image.Rectangle, width int, height int) image.Image {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, r, draw.Src, nil)
+	return dst
+}
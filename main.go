@@ -1,18 +1,20 @@
 package main
 
 import (
-	"cloud.google.com/go/storage"
 	"context"
 	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"image-processor/pb"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -29,46 +31,171 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
+	db, err := openDatabase()
+	if err != nil {
+		level.Error(logger).Log("component", "openDatabase", "msg", err)
+		os.Exit(1)
+	}
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(db, os.Args[1:]))
+	}
+
+	errs := make(chan error)
 	ctx := context.Background()
-	storageClient, err := storage.NewClient(ctx, option.WithCredentialsJSON([]byte(viper.GetString("GCP_CLIENT_SECRET"))))
+	shutdownTracing, err := MakeTracerProvider(ctx)
 	if err != nil {
-		level.Error(logger).Log("component", "storage.NewClient", "msg", err)
-	} else {
-		defer storageClient.Close()
+		level.Error(logger).Log("component", "MakeTracerProvider", "msg", err)
+		os.Exit(1)
 	}
+	defer shutdownTracing(ctx)
 
-	dsn := "host=" + viper.GetString("DB_HOST") +
-		" user=" + viper.GetString("DB_USER") +
-		" password=" + viper.GetString("DB_PASS") +
-		" dbname=" + viper.GetString("DB_NAME") +
-		" port=" + viper.GetString("DB_PORT") +
-		" sslmode=" + viper.GetString("DB_SSL") +
-		" TimeZone=" + viper.GetString("DB_TIMEZONE")
-	db, _ := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	store, err := MakeObjectStore(ctx)
+	if err != nil {
+		level.Error(logger).Log("component", "MakeObjectStore", "msg", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	if handler, ok := store.(http.Handler); ok {
+		viper.SetDefault("STORAGE_LOCAL_ADDR", ":8080")
+		go func() {
+			level.Info(logger).Log("component", "storageServer", "msg", "Serving local storage", "context", viper.GetString("STORAGE_LOCAL_ADDR"))
+			errs <- http.ListenAndServe(viper.GetString("STORAGE_LOCAL_ADDR"), handler)
+		}()
+	}
+
+	metrics := MakeMetrics()
+	fetcher := MakeFetcher(metrics.DownloadLatency)
+	resizers, err := MakeResizers(viper.GetString("RESIZE_BACKENDS"), fetcher, metrics)
+	if err != nil {
+		level.Error(logger).Log("component", "MakeResizers", "msg", err)
+		os.Exit(1)
+	}
+
+	viper.SetDefault("SOURCE_MAX_MEGAPIXELS", 40)
+	viper.SetDefault("KEEP_ICC_PROFILE", true)
+	viper.SetDefault("STORAGE_CACHE_CONTROL", "public, max-age=31536000, immutable")
+	viper.SetDefault("WORKER_POOL_SIZE", 4)
+	viper.SetDefault("JOB_LEASE", "5m")
+	viper.SetDefault("JOB_POLL_INTERVAL", "2s")
+	viper.SetDefault("JOB_MAX_ATTEMPTS", 5)
+	viper.SetDefault("JOB_RETRY_BACKOFF", "10s")
+	viper.SetDefault("JOB_RETRY_MAX_BACKOFF", "10m")
+	presets, err := ParsePresets(viper.GetString("VARIANT_PRESETS"))
+	if err != nil {
+		level.Error(logger).Log("component", "ParsePresets", "msg", err)
+		os.Exit(1)
+	}
 
-	service := MakeService(logger, db, storageClient)
+	viper.SetDefault("WATCH_POLL_INTERVAL", "1s")
+	formats, err := MakeVariantFormats(resizers, viper.GetString("VARIANT_SIBLING_FORMATS"))
+	if err != nil {
+		level.Error(logger).Log("component", "MakeVariantFormats", "msg", err)
+		os.Exit(1)
+	}
+	// Workers, health checks and watch streams stop on runCtx; ctx stays
+	// alive for the clients that are still needed while shutting down.
+	runCtx, stop := context.WithCancel(ctx)
+	service := MakeService(logger, db, presets, formats, viper.GetDuration("WATCH_POLL_INTERVAL"), runCtx.Done())
+	service = MakeInstrumentingService(metrics, service)
+	workerPool := MakeWorkerPool(logger, db, store, fetcher,
+		ImagePolicy{
+			MaxPixels:    int64(viper.GetFloat64("SOURCE_MAX_MEGAPIXELS") * 1e6),
+			KeepICC:      viper.GetBool("KEEP_ICC_PROFILE"),
+			CacheControl: viper.GetString("STORAGE_CACHE_CONTROL"),
+		},
+		resizers,
+		viper.GetInt("WORKER_POOL_SIZE"),
+		viper.GetDuration("JOB_LEASE"),
+		viper.GetDuration("JOB_POLL_INTERVAL"),
+		RetryPolicy{
+			MaxAttempts: viper.GetInt("JOB_MAX_ATTEMPTS"),
+			Backoff:     viper.GetDuration("JOB_RETRY_BACKOFF"),
+			MaxBackoff:  viper.GetDuration("JOB_RETRY_MAX_BACKOFF"),
+		},
+		metrics)
+	go workerPool.Run(runCtx)
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", "10s")
+	healthChecker := MakeHealthChecker(logger, db, store, workerPool, viper.GetDuration("HEALTH_CHECK_INTERVAL"))
+	go healthChecker.Run(runCtx)
 	endpoint := MakeEndpoints(logger, service)
 	grpcServer := NewGRPCServer(logger, endpoint)
 
-	errs := make(chan error)
 	go func() {
-		c := make(chan os.Signal)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		errs <- fmt.Errorf("%s", <-c)
 	}()
 
+	viper.SetDefault("METRICS_ADDR", ":9090")
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		level.Info(logger).Log("component", "metricsServer", "msg", "Serving metrics", "context", viper.GetString("METRICS_ADDR"))
+		errs <- http.ListenAndServe(viper.GetString("METRICS_ADDR"), mux)
+	}()
+
 	grpcListener, err := net.Listen("tcp", grpcAddr)
 	if err != nil {
 		level.Error(logger).Log("component", "grpcListener", "msg", err)
 		os.Exit(1)
 	}
 
+	baseServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), UnaryRequestIdInterceptor),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(), StreamRequestIdInterceptor),
+	)
+	pb.RegisterImageProcessorServiceServer(baseServer, grpcServer)
+	healthpb.RegisterHealthServer(baseServer, healthChecker.Server())
 	go func() {
-		baseServer := grpc.NewServer()
-		pb.RegisterImageProcessorServiceServer(baseServer, grpcServer)
 		level.Info(logger).Log("component", "grpcServer", "msg", "Server started successfully!", "context", "port"+grpcAddr)
-		baseServer.Serve(grpcListener)
+		errs <- baseServer.Serve(grpcListener)
 	}()
 
 	level.Error(logger).Log("status", "exit", "msg", <-errs)
+
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "25s")
+	shutdownCtx, cancel := context.WithTimeout(ctx, viper.GetDuration("SHUTDOWN_TIMEOUT"))
+	defer cancel()
+	stop()
+	// The server and the workers are stopped side by side, so neither uses up
+	// the other's share of the timeout.
+	serverStopped := make(chan struct{})
+	go func() {
+		gracefulStop(shutdownCtx, baseServer)
+		close(serverStopped)
+	}()
+	if err := workerPool.Drain(shutdownCtx); err != nil {
+		level.Warn(logger).Log("component", "workerPool", "msg", "Interrupted unfinished jobs", "context", err)
+	}
+	<-serverStopped
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	level.Info(logger).Log("status", "exit", "msg", "Shutdown complete")
+}
+
+// gracefulStop stops accepting RPCs and waits for the running ones until ctx
+// expires, when they are cancelled.
+func gracefulStop(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+func openDatabase() (*gorm.DB, error) {
+	dsn := "host=" + viper.GetString("DB_HOST") +
+		" user=" + viper.GetString("DB_USER") +
+		" password=" + viper.GetString("DB_PASS") +
+		" dbname=" + viper.GetString("DB_NAME") +
+		" port=" + viper.GetString("DB_PORT") +
+		" sslmode=" + viper.GetString("DB_SSL") +
+		" TimeZone=" + viper.GetString("DB_TIMEZONE")
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
 }
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+// Photos taken by phones carry their orientation and often the location
+// they were taken at in EXIF. Variants get the orientation applied to their
+// pixels and every EXIF, XMP, IPTC and comment block removed, whichever
+// backend produced them. Only the ICC profile may be kept, as it is needed
+// to show the colours right.
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+	iccHeader    = []byte("ICC_PROFILE\x00")
+)
+
+// maxICCChunk is the most ICC profile data that fits into one JPEG APP2
+// segment besides the header and the chunk sequence numbers.
+const maxICCChunk = 0xffff - 2 - 12 - 2
+
+// sanitizeImage strips all metadata from a variant. With keepICC, the ICC
+// profile of the variant is kept, or the one of the original is added when
+// the backend dropped it.
+func sanitizeImage(data []byte, original []byte, keepICC bool) ([]byte, error) {
+	data, err := stripMetadata(data, keepICC)
+	if err != nil || !keepICC || iccProfile(data) != nil {
+		return data, err
+	}
+	profile := iccProfile(original)
+	if len(profile) < 20 {
+		return data, nil
+	}
+	// The pixels of resized variants are RGB or gray, so profiles of other
+	// colour spaces, e.g. from CMYK originals, would be wrong for them.
+	if space := string(profile[16:20]); space != "RGB " && space != "GRAY" {
+		return data, nil
+	}
+	return embedICC(data, profile)
+}
+
+// stripMetadata removes all metadata blocks from a JPEG, PNG, GIF or WebP
+// image and keeps its pixel data untouched. Other formats are refused, as
+// they could not be checked.
+func stripMetadata(data []byte, keepICC bool) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return stripJpeg(data, keepICC)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPng(data, keepICC)
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return stripGif(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebp(data, keepICC)
+	}
+	return nil, fmt.Errorf("can not strip metadata of %s", http.DetectContentType(data))
+}
+
+// jpegSegment is a marker segment of a JPEG file, including its marker.
+type jpegSegment struct {
+	marker byte
+	data   []byte
+}
+
+// payload returns the segment data after its marker and length.
+func (segment jpegSegment) payload() []byte {
+	if len(segment.data) < 4 {
+		return nil
+	}
+	return segment.data[4:]
+}
+
+// jpegSegments splits a JPEG file into the segments before its first scan
+// and the rest of the file, from the start of scan marker on.
+func jpegSegments(data []byte) ([]jpegSegment, []byte, error) {
+	var segments []jpegSegment
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xff {
+			return nil, nil, fmt.Errorf("jpeg: missing marker at %d", i)
+		}
+		for i+1 < len(data) && data[i+1] == 0xff {
+			i++
+		}
+		if i+1 >= len(data) {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xda {
+			return segments, data[i:], nil
+		}
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd8 {
+			segments = append(segments, jpegSegment{marker, data[i : i+2]})
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			break
+		}
+		segments = append(segments, jpegSegment{marker, data[i:end]})
+		i = end
+	}
+	return nil, nil, fmt.Errorf("jpeg: truncated before first scan")
+}
+
+func stripJpeg(data []byte, keepICC bool) ([]byte, error) {
+	segments, scan, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	for _, segment := range segments {
+		if keepJpegSegment(segment, keepICC) {
+			out.Write(segment.data)
+		}
+	}
+	out.Write(scan)
+	return out.Bytes(), nil
+}
+
+// keepJpegSegment tells whether a segment is needed to decode the image.
+// APP0 (JFIF) and APP14 (Adobe colour transform) are, APP2 is only kept for
+// ICC profiles, and all other application segments and comments go.
+func keepJpegSegment(segment jpegSegment, keepICC bool) bool {
+	switch {
+	case segment.marker == 0xe0 || segment.marker == 0xee:
+		return true
+	case segment.marker == 0xe2:
+		return keepICC && bytes.HasPrefix(segment.payload(), iccHeader)
+	case segment.marker > 0xe0 && segment.marker <= 0xef, segment.marker == 0xfe:
+		return false
+	}
+	return true
+}
+
+// pngChunk is a chunk of a PNG file, including its length, type and CRC.
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+func (chunk pngChunk) payload() []byte {
+	return chunk.data[8 : len(chunk.data)-4]
+}
+
+func pngChunks(data []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, fmt.Errorf("png: truncated chunk at %d", i)
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("png: truncated chunk at %d", i)
+		}
+		chunks = append(chunks, pngChunk{string(data[i+4 : i+8]), data[i:end]})
+		i = end
+	}
+	return chunks, nil
+}
+
+// pngMetadata are the chunks carrying metadata: EXIF, textual data, which
+// also holds XMP, and the modification time.
+var pngMetadata = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPng(data []byte, keepICC bool) ([]byte, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for _, chunk := range chunks {
+		if pngMetadata[chunk.kind] || chunk.kind == "iCCP" && !keepICC {
+			continue
+		}
+		out.Write(chunk.data)
+	}
+	return out.Bytes(), nil
+}
+
+// stripGif removes comment extensions and application extensions except the
+// ones controlling animation loops. XMP is stored in an application
+// extension.
+func stripGif(data []byte) ([]byte, error) {
+	truncated := fmt.Errorf("gif: truncated")
+	if len(data) < 13 {
+		return nil, truncated
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&7 + 1)
+	}
+	if i > len(data) {
+		return nil, truncated
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:i])
+	for i < len(data) {
+		start := i
+		keep := true
+		switch data[i] {
+		case 0x3b:
+			out.WriteByte(0x3b)
+			return out.Bytes(), nil
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, truncated
+			}
+			switch data[i+1] {
+			case 0xfe:
+				keep = false
+			case 0xff:
+				id := data[i+2:]
+				keep = bytes.HasPrefix(id, []byte("\x0bNETSCAPE2.0")) || bytes.HasPrefix(id, []byte("\x0bANIMEXTS1.0"))
+			}
+			i += 2
+		case 0x2c:
+			if i+10 > len(data) {
+				return nil, truncated
+			}
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << (packed&7 + 1)
+			}
+			i++ // LZW minimum code size
+		default:
+			return nil, fmt.Errorf("gif: unknown block %#x at %d", data[i], i)
+		}
+		for i < len(data) && data[i] != 0 {
+			i += int(data[i]) + 1
+		}
+		i++
+		if i > len(data) {
+			return nil, truncated
+		}
+		if keep {
+			out.Write(data[start:i])
+		}
+	}
+	return nil, truncated
+}
+
+// WebP VP8X header flags announcing metadata chunks.
+const (
+	webpFlagICC  = 0x20
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebp removes the EXIF and XMP chunks, and the ICC profile unless
+// keepICC, from a WebP image and clears their flags in the VP8X header.
+func stripWebp(data []byte, keepICC bool) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	dropped := byte(webpFlagEXIF | webpFlagXMP)
+	if !keepICC {
+		dropped |= webpFlagICC
+	}
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("webp: truncated chunk at %d", i)
+		}
+		kind := string(data[i : i+4])
+		end := i + 8 + int(binary.LittleEndian.Uint32(data[i+4:]))
+		if end%2 == 1 {
+			end++
+		}
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("webp: truncated chunk at %d", i)
+		}
+		switch {
+		case kind == "EXIF" || kind == "XMP " || kind == "ICCP" && !keepICC:
+		case kind == "VP8X" && end-i >= 9:
+			out.Write(data[i : i+8])
+			out.WriteByte(data[i+8] &^ dropped)
+			out.Write(data[i+9 : end])
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
+
+// iccProfile returns the ICC profile embedded in a JPEG or PNG image, or nil.
+func iccProfile(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		segments, _, err := jpegSegments(data)
+		if err != nil {
+			return nil
+		}
+		// Large profiles are split over several APP2 segments, numbered
+		// from 1.
+		chunks := map[int][]byte{}
+		for _, segment := range segments {
+			payload := segment.payload()
+			if segment.marker == 0xe2 && bytes.HasPrefix(payload, iccHeader) && len(payload) > len(iccHeader)+2 {
+				chunks[int(payload[len(iccHeader)])] = payload[len(iccHeader)+2:]
+			}
+		}
+		var seqs []int
+		for seq := range chunks {
+			seqs = append(seqs, seq)
+		}
+		sort.Ints(seqs)
+		var profile []byte
+		for _, seq := range seqs {
+			profile = append(profile, chunks[seq]...)
+		}
+		return profile
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, err := pngChunks(data)
+		if err != nil {
+			return nil
+		}
+		for _, chunk := range chunks {
+			if chunk.kind != "iCCP" {
+				continue
+			}
+			payload := chunk.payload()
+			name := bytes.IndexByte(payload, 0)
+			if name < 0 || name+2 > len(payload) {
+				return nil
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(payload[name+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+	}
+	return nil
+}
+
+// embedICC adds an ICC profile to a JPEG or PNG image without one. Other
+// formats are returned unchanged.
+func embedICC(data []byte, profile []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		segments, scan, err := jpegSegments(data)
+		if err != nil {
+			return nil, err
+		}
+		count := (len(profile) + maxICCChunk - 1) / maxICCChunk
+		if count > 255 {
+			return data, nil
+		}
+		out := bytes.NewBuffer(make([]byte, 0, len(data)+len(profile)+count*18))
+		out.Write(data[:2])
+		// JFIF requires its APP0 segment to come first.
+		if len(segments) > 0 && segments[0].marker == 0xe0 {
+			out.Write(segments[0].data)
+			segments = segments[1:]
+		}
+		for seq := 1; seq <= count; seq++ {
+			chunk := profile[(seq-1)*maxICCChunk:]
+			if len(chunk) > maxICCChunk {
+				chunk = chunk[:maxICCChunk]
+			}
+			out.Write([]byte{0xff, 0xe2})
+			binary.Write(out, binary.BigEndian, uint16(2+len(iccHeader)+2+len(chunk)))
+			out.Write(iccHeader)
+			out.Write([]byte{byte(seq), byte(count)})
+			out.Write(chunk)
+		}
+		for _, segment := range segments {
+			out.Write(segment.data)
+		}
+		out.Write(scan)
+		return out.Bytes(), nil
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, err := pngChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		writer.Write(profile)
+		writer.Close()
+		payload := append([]byte("ICC Profile\x00\x00"), compressed.Bytes()...)
+
+		out := bytes.NewBuffer(make([]byte, 0, len(data)+len(payload)+12))
+		out.Write(pngSignature)
+		for _, chunk := range chunks {
+			out.Write(chunk.data)
+			// iCCP has to precede PLTE and IDAT, so it goes right after the
+			// header.
+			if chunk.kind == "IHDR" {
+				binary.Write(out, binary.BigEndian, uint32(len(payload)))
+				crc := crc32.NewIEEE()
+				crc.Write([]byte("iCCP"))
+				crc.Write(payload)
+				out.WriteString("iCCP")
+				out.Write(payload)
+				binary.Write(out, binary.BigEndian, crc.Sum32())
+			}
+		}
+		return out.Bytes(), nil
+	}
+	return data, nil
+}
+
+// exifOrientation returns the EXIF orientation of a JPEG or PNG image, from
+// 1 to 8, or 1 when it has none.
+func exifOrientation(data []byte) int {
+	var exif []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		segments, _, err := jpegSegments(data)
+		if err != nil {
+			return 1
+		}
+		for _, segment := range segments {
+			if segment.marker == 0xe1 && bytes.HasPrefix(segment.payload(), exifHeader) {
+				exif = segment.payload()[len(exifHeader):]
+				break
+			}
+		}
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, err := pngChunks(data)
+		if err != nil {
+			return 1
+		}
+		for _, chunk := range chunks {
+			if chunk.kind == "eXIf" {
+				exif = chunk.payload()
+				break
+			}
+		}
+	}
+	orientation := tiffOrientation(exif)
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of TIFF
+// formatted EXIF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// orient applies an EXIF orientation to the pixels of img, so that it is
+// shown upright without the tag.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	// Orientations 5 to 8 are transposed, so width and height swap.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	src, ok := img.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// secret stands for the location and other personal data metadata blocks
+// carry. None of it may survive stripping.
+var secret = []byte("GPS 47.376887N 8.541694E")
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 32), 128, 255})
+		}
+	}
+	return img
+}
+
+func testICC() []byte {
+	profile := make([]byte, 128)
+	copy(profile[16:], "RGB ")
+	copy(profile[100:], "test profile")
+	return profile
+}
+
+func jpegSegmentOf(marker byte, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(data)))
+	return append(segment, data...)
+}
+
+// jpegWith returns a JPEG with the segments inserted after its JFIF header.
+func jpegWith(t *testing.T, segments ...[]byte) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	app0 := 4 + int(binary.BigEndian.Uint16(data[4:]))
+	out := append([]byte{}, data[:app0]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[app0:]...)
+}
+
+func pngChunkOf(kind string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, kind...), data...)
+	return append(chunk, make([]byte, 4)...)
+}
+
+// pngWith returns a PNG with the chunks inserted after its header. CRCs are
+// filled in.
+func pngWith(t *testing.T, chunks ...[]byte) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	ihdr := len(pngSignature) + 12 + 13
+	out := append([]byte{}, data[:ihdr]...)
+	for _, chunk := range chunks {
+		binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+		out = append(out, chunk...)
+	}
+	return append(out, data[ihdr:]...)
+}
+
+// gifWith returns a GIF with the extension blocks inserted before its
+// trailer.
+func gifWith(t *testing.T, blocks ...[]byte) []byte {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:len(data)-1]...)
+	for _, block := range blocks {
+		out = append(out, block...)
+	}
+	return append(out, 0x3b)
+}
+
+func gifExtension(label byte, blocks ...[]byte) []byte {
+	extension := []byte{0x21, label}
+	for _, block := range blocks {
+		extension = append(append(extension, byte(len(block))), block...)
+	}
+	return append(extension, 0)
+}
+
+func webpChunkOf(kind string, payload []byte) []byte {
+	chunk := make([]byte, 8, 9+len(payload))
+	copy(chunk, kind)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpWith returns an extended WebP file with the given chunks after its
+// VP8X header, which announces ICC, EXIF and XMP.
+func webpWith(chunks ...[]byte) []byte {
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpFlagICC | webpFlagEXIF | webpFlagXMP
+	body := append([]byte("WEBP"), webpChunkOf("VP8X", vp8x)...)
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	header := make([]byte, 8)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(body)))
+	return append(header, body...)
+}
+
+func TestStripMetadata(t *testing.T) {
+	icc := testICC()
+	iccSegment := jpegSegmentOf(0xe2, iccHeader, []byte{1, 1}, icc)
+	pngICC, err := embedICC(pngWith(t, pngChunkOf("tEXt", []byte("Comment\x00"), secret)), icc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		keepICC bool
+		wantICC bool
+	}{
+		{
+			name: "jpeg",
+			data: jpegWith(t,
+				jpegSegmentOf(0xe1, exifHeader, secret),
+				jpegSegmentOf(0xe1, []byte("http://ns.adobe.com/xap/1.0/\x00"), secret),
+				jpegSegmentOf(0xed, []byte("Photoshop 3.0\x00"), secret),
+				jpegSegmentOf(0xfe, secret),
+				iccSegment,
+			),
+			keepICC: true,
+			wantICC: true,
+		},
+		{
+			name:    "jpeg without icc",
+			data:    jpegWith(t, jpegSegmentOf(0xe1, exifHeader, secret), iccSegment),
+			keepICC: false,
+		},
+		{
+			name: "png",
+			data: pngWith(t,
+				pngChunkOf("eXIf", secret),
+				pngChunkOf("tEXt", []byte("Comment\x00"), secret),
+				pngChunkOf("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), secret),
+				pngChunkOf("zTXt", []byte("Raw profile type exif\x00\x00"), secret),
+			),
+		},
+		{
+			name:    "png keeps icc",
+			data:    pngICC,
+			keepICC: true,
+			wantICC: true,
+		},
+		{
+			name: "gif",
+			data: gifWith(t,
+				gifExtension(0xfe, secret),
+				gifExtension(0xff, []byte("XMP DataXMP"), secret),
+			),
+		},
+		{
+			name: "webp",
+			data: webpWith(
+				webpChunkOf("ICCP", icc),
+				webpChunkOf("EXIF", append(append([]byte{}, exifHeader...), secret...)),
+				webpChunkOf("XMP ", secret),
+				webpChunkOf("VP8L", []byte{0x2f, 0, 0, 0, 0}),
+			),
+			keepICC: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stripped, err := stripMetadata(test.data, test.keepICC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(stripped, secret) {
+				t.Errorf("metadata left in %q", stripped)
+			}
+			if test.wantICC && !bytes.Equal(iccProfile(stripped), icc) {
+				t.Errorf("ICC profile = %q, want %q", iccProfile(stripped), icc)
+			}
+			if !test.keepICC && bytes.Contains(stripped, icc[100:112]) {
+				t.Error("ICC profile left without keepICC")
+			}
+			if bytes.HasPrefix(stripped, []byte("RIFF")) {
+				if size := binary.LittleEndian.Uint32(stripped[4:]); int(size) != len(stripped)-8 {
+					t.Errorf("RIFF size = %d, want %d", size, len(stripped)-8)
+				}
+				if flags := stripped[20]; flags != webpFlagICC {
+					t.Errorf("VP8X flags = %#x, want %#x", flags, webpFlagICC)
+				}
+				if !bytes.Contains(stripped, icc[100:112]) {
+					t.Error("ICC profile dropped with keepICC")
+				}
+				return
+			}
+			if _, _, err := image.Decode(bytes.NewReader(stripped)); err != nil {
+				t.Errorf("stripped image does not decode: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const metricsNamespace = "image_processor"
+
+// Metrics are the Prometheus metrics of the service and the resize
+// pipeline.
+type Metrics struct {
+	RequestCount    metrics.Counter
+	RequestLatency  metrics.Histogram
+	ResizeCount     metrics.Counter
+	ResizeLatency   metrics.Histogram
+	Fallbacks       metrics.Counter
+	DownloadLatency metrics.Histogram
+	UploadLatency   metrics.Histogram
+	UploadedBytes   metrics.Counter
+	SkippedUploads  metrics.Counter
+	QueueDepth      metrics.Gauge
+}
+
+func MakeMetrics() *Metrics {
+	return &Metrics{
+		RequestCount: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Number of RPCs received.",
+		}, []string{"method", "error"}),
+		RequestLatency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of RPCs in seconds.",
+		}, []string{"method", "error"}),
+		ResizeCount: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "resize_total",
+			Help:      "Number of resize attempts per backend and outcome.",
+		}, []string{"backend", "outcome"}),
+		ResizeLatency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "resize_duration_seconds",
+			Help:      "Duration of resize attempts per backend in seconds.",
+			Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 25, 50},
+		}, []string{"backend"}),
+		Fallbacks: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "resize_fallbacks_total",
+			Help:      "Number of times a resize fell back to the given backend.",
+		}, []string{"backend"}),
+		DownloadLatency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "download_duration_seconds",
+			Help:      "Duration of image downloads in seconds.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 25},
+		}, []string{"source"}),
+		UploadLatency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upload_duration_seconds",
+			Help:      "Duration of variant uploads to storage in seconds.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 25},
+		}, []string{}),
+		UploadedBytes: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "uploaded_bytes_total",
+			Help:      "Number of bytes written to storage.",
+		}, []string{}),
+		SkippedUploads: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "skipped_uploads_total",
+			Help:      "Number of variants not uploaded because their object already existed.",
+		}, []string{}),
+		QueueDepth: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "queue_depth",
+			Help:      "Number of processing jobs per state.",
+		}, []string{"state"}),
+	}
+}
+
+// instrumentingService records the count and latency of every RPC.
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	next           Service
+}
+
+func MakeInstrumentingService(m *Metrics, next Service) Service {
+	return &instrumentingService{
+		requestCount:   m.RequestCount,
+		requestLatency: m.RequestLatency,
+		next:           next,
+	}
+}
+
+func (mw instrumentingService) observe(method string, begin time.Time, err error) {
+	lvs := []string{"method", method, "error", fmt.Sprint(err != nil)}
+	mw.requestCount.With(lvs...).Add(1)
+	mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+}
+
+func (mw instrumentingService) ProcessImage(ctx context.Context, id uint32, specs []VariantSpec) (err error) {
+	defer func(begin time.Time) { mw.observe("Process", begin, err) }(time.Now())
+	return mw.next.ProcessImage(ctx, id, specs)
+}
+
+func (mw instrumentingService) GetStatus(ctx context.Context, id uint32) (status PhotoStatus, err error) {
+	defer func(begin time.Time) { mw.observe("GetStatus", begin, err) }(time.Now())
+	return mw.next.GetStatus(ctx, id)
+}
+
+func (mw instrumentingService) WatchProcessing(ctx context.Context, id uint32, send func(VariantStatus) error) (err error) {
+	defer func(begin time.Time) { mw.observe("WatchProcessing", begin, err) }(time.Now())
+	return mw.next.WatchProcessing(ctx, id, send)
+}
+
+func (mw instrumentingService) ProcessBatch(ctx context.Context, ids []uint32, idAd uint32, specs []VariantSpec) (items []BatchItem, err error) {
+	defer func(begin time.Time) { mw.observe("ProcessBatch", begin, err) }(time.Now())
+	return mw.next.ProcessBatch(ctx, ids, idAd, specs)
+}
+
+func (mw instrumentingService) FindSimilar(ctx context.Context, id uint32, maxDistance int, limit int) (similar []SimilarPhoto, err error) {
+	defer func(begin time.Time) { mw.observe("FindSimilar", begin, err) }(time.Now())
+	return mw.next.FindSimilar(ctx, id, maxDistance, limit)
+}
+
+func (mw instrumentingService) DeletePhoto(ctx context.Context, id uint32, deleteOriginal bool) (err error) {
+	defer func(begin time.Time) { mw.observe("DeletePhoto", begin, err) }(time.Now())
+	return mw.next.DeletePhoto(ctx, id, deleteOriginal)
+}
+
+func (mw instrumentingService) DeleteAd(ctx context.Context, idAd uint32, deleteOriginal bool) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteAd", begin, err) }(time.Now())
+	return mw.next.DeleteAd(ctx, idAd, deleteOriginal)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// variantPrefix is where content addressed variants are stored.
+const variantPrefix = "variants/"
+
+// StorageObject counts the variants referencing an object of the store.
+// Variants are stored under a key derived from their content, so identical
+// outputs share one object and reprocessing a photo does not orphan the
+// objects it replaces unnoticed: once no variant references an object any
+// more, UnreferencedAt is set and the object can be collected.
+type StorageObject struct {
+	Key            string `gorm:"primaryKey"`
+	Size           int64
+	RefCount       int
+	UnreferencedAt *time.Time `gorm:"index"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (StorageObject) TableName() string {
+	return "t_storage_object"
+}
+
+// variantKey returns the storage key of a variant: the SHA-256 of the spec
+// it was produced for and its bytes, with the format as extension.
+func variantKey(data []byte, spec ResizeSpec, format string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%dx%d;%s;%s;%d\n", spec.Width, spec.Height, spec.Fit, spec.Format, spec.Quality)
+	hash.Write(data)
+	return fmt.Sprintf("%s%s.%s", variantPrefix, hex.EncodeToString(hash.Sum(nil)), format)
+}
+
+// referenceObject adds a reference to the object stored under key.
+func referenceObject(tx *gorm.DB, key string, size int64) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"ref_count":       gorm.Expr("t_storage_object.ref_count + 1"),
+			"unreferenced_at": nil,
+			"updated_at":      time.Now(),
+		}),
+	}).Create(&StorageObject{Key: key, Size: size, RefCount: 1}).Error
+}
+
+// releaseObject drops a reference to the object stored under key. Objects
+// that were uploaded before references were counted are recorded as
+// unreferenced, so they are collected as well.
+func releaseObject(tx *gorm.DB, key string) error {
+	now := time.Now()
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"ref_count":       gorm.Expr("GREATEST(t_storage_object.ref_count - 1, 0)"),
+			"unreferenced_at": gorm.Expr("CASE WHEN t_storage_object.ref_count <= 1 THEN ? ELSE NULL END", now),
+			"updated_at":      now,
+		}),
+	}).Create(&StorageObject{Key: key, UnreferencedAt: &now}).Error
+}
@@ -25,12 +25,121 @@ const (
 // of the legacy proto package is being used.
 const _ = proto.ProtoPackageIsVersion4
 
+type FitMode int32
+
+const (
+	FitMode_FitContain FitMode = 0
+	FitMode_FitCover   FitMode = 1
+	FitMode_FitExact   FitMode = 2
+)
+
+// Enum value maps for FitMode.
+var (
+	FitMode_name = map[int32]string{
+		0: "FitContain",
+		1: "FitCover",
+		2: "FitExact",
+	}
+	FitMode_value = map[string]int32{
+		"FitContain": 0,
+		"FitCover":   1,
+		"FitExact":   2,
+	}
+)
+
+func (x FitMode) Enum() *FitMode {
+	p := new(FitMode)
+	*p = x
+	return p
+}
+
+func (x FitMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FitMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_pb_image_processor_proto_enumTypes[0].Descriptor()
+}
+
+func (FitMode) Type() protoreflect.EnumType {
+	return &file_pb_image_processor_proto_enumTypes[0]
+}
+
+func (x FitMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FitMode.Descriptor instead.
+func (FitMode) EnumDescriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{0}
+}
+
+type ImageFormat int32
+
+const (
+	ImageFormat_FormatOriginal ImageFormat = 0
+	ImageFormat_FormatJpeg     ImageFormat = 1
+	ImageFormat_FormatPng      ImageFormat = 2
+	ImageFormat_FormatWebp     ImageFormat = 3
+	ImageFormat_FormatAvif     ImageFormat = 4
+)
+
+// Enum value maps for ImageFormat.
+var (
+	ImageFormat_name = map[int32]string{
+		0: "FormatOriginal",
+		1: "FormatJpeg",
+		2: "FormatPng",
+		3: "FormatWebp",
+		4: "FormatAvif",
+	}
+	ImageFormat_value = map[string]int32{
+		"FormatOriginal": 0,
+		"FormatJpeg":     1,
+		"FormatPng":      2,
+		"FormatWebp":     3,
+		"FormatAvif":     4,
+	}
+)
+
+func (x ImageFormat) Enum() *ImageFormat {
+	p := new(ImageFormat)
+	*p = x
+	return p
+}
+
+func (x ImageFormat) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ImageFormat) Descriptor() protoreflect.EnumDescriptor {
+	return file_pb_image_processor_proto_enumTypes[1].Descriptor()
+}
+
+func (ImageFormat) Type() protoreflect.EnumType {
+	return &file_pb_image_processor_proto_enumTypes[1]
+}
+
+func (x ImageFormat) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ImageFormat.Descriptor instead.
+func (ImageFormat) EnumDescriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{1}
+}
+
 type StatusCode int32
 
 const (
-	StatusCode_Unknown StatusCode = 0
-	StatusCode_Ok      StatusCode = 1
-	StatusCode_Failed  StatusCode = 2
+	StatusCode_Unknown           StatusCode = 0
+	StatusCode_Ok                StatusCode = 1
+	StatusCode_Failed            StatusCode = 2
+	StatusCode_NotFound          StatusCode = 3
+	StatusCode_InvalidArgument   StatusCode = 4
+	StatusCode_Unavailable       StatusCode = 5
+	StatusCode_AlreadyProcessing StatusCode = 6
+	StatusCode_NotReady          StatusCode = 7
 )
 
 // Enum value maps for StatusCode.
@@ -39,11 +148,21 @@ var (
 		0: "Unknown",
 		1: "Ok",
 		2: "Failed",
+		3: "NotFound",
+		4: "InvalidArgument",
+		5: "Unavailable",
+		6: "AlreadyProcessing",
+		7: "NotReady",
 	}
 	StatusCode_value = map[string]int32{
-		"Unknown": 0,
-		"Ok":      1,
-		"Failed":  2,
+		"Unknown":           0,
+		"Ok":                1,
+		"Failed":            2,
+		"NotFound":          3,
+		"InvalidArgument":   4,
+		"Unavailable":       5,
+		"AlreadyProcessing": 6,
+		"NotReady":          7,
 	}
 )
 
@@ -58,11 +177,11 @@ func (x StatusCode) String() string {
 }
 
 func (StatusCode) Descriptor() protoreflect.EnumDescriptor {
-	return file_pb_image_processor_proto_enumTypes[0].Descriptor()
+	return file_pb_image_processor_proto_enumTypes[2].Descriptor()
 }
 
 func (StatusCode) Type() protoreflect.EnumType {
-	return &file_pb_image_processor_proto_enumTypes[0]
+	return &file_pb_image_processor_proto_enumTypes[2]
 }
 
 func (x StatusCode) Number() protoreflect.EnumNumber {
@@ -71,7 +190,68 @@ func (x StatusCode) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use StatusCode.Descriptor instead.
 func (StatusCode) EnumDescriptor() ([]byte, []int) {
-	return file_pb_image_processor_proto_rawDescGZIP(), []int{0}
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{2}
+}
+
+type ProcessingState int32
+
+const (
+	ProcessingState_ProcessingUnknown   ProcessingState = 0
+	ProcessingState_ProcessingQueued    ProcessingState = 1
+	ProcessingState_ProcessingRunning   ProcessingState = 2
+	ProcessingState_ProcessingSucceeded ProcessingState = 3
+	ProcessingState_ProcessingFailed    ProcessingState = 4
+	ProcessingState_ProcessingDead      ProcessingState = 5
+	ProcessingState_ProcessingInvalid   ProcessingState = 6
+)
+
+// Enum value maps for ProcessingState.
+var (
+	ProcessingState_name = map[int32]string{
+		0: "ProcessingUnknown",
+		1: "ProcessingQueued",
+		2: "ProcessingRunning",
+		3: "ProcessingSucceeded",
+		4: "ProcessingFailed",
+		5: "ProcessingDead",
+		6: "ProcessingInvalid",
+	}
+	ProcessingState_value = map[string]int32{
+		"ProcessingUnknown":   0,
+		"ProcessingQueued":    1,
+		"ProcessingRunning":   2,
+		"ProcessingSucceeded": 3,
+		"ProcessingFailed":    4,
+		"ProcessingDead":      5,
+		"ProcessingInvalid":   6,
+	}
+)
+
+func (x ProcessingState) Enum() *ProcessingState {
+	p := new(ProcessingState)
+	*p = x
+	return p
+}
+
+func (x ProcessingState) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProcessingState) Descriptor() protoreflect.EnumDescriptor {
+	return file_pb_image_processor_proto_enumTypes[3].Descriptor()
+}
+
+func (ProcessingState) Type() protoreflect.EnumType {
+	return &file_pb_image_processor_proto_enumTypes[3]
+}
+
+func (x ProcessingState) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProcessingState.Descriptor instead.
+func (ProcessingState) EnumDescriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{3}
 }
 
 type Image struct {
@@ -80,6 +260,11 @@ type Image struct {
 	unknownFields protoimpl.UnknownFields
 
 	Id uint32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Variants to produce. When empty the server-side presets are used.
+	Variants []*VariantSpec `protobuf:"bytes,2,rep,name=variants,proto3" json:"variants,omitempty"`
+	// Whether DeletePhoto deletes the original as well. Only originals in the
+	// image bucket can be deleted.
+	DeleteOriginal bool `protobuf:"varint,3,opt,name=delete_original,json=deleteOriginal,proto3" json:"delete_original,omitempty"`
 }
 
 func (x *Image) Reset() {
@@ -121,6 +306,167 @@ func (x *Image) GetId() uint32 {
 	return 0
 }
 
+func (x *Image) GetVariants() []*VariantSpec {
+	if x != nil {
+		return x.Variants
+	}
+	return nil
+}
+
+func (x *Image) GetDeleteOriginal() bool {
+	if x != nil {
+		return x.DeleteOriginal
+	}
+	return false
+}
+
+type AdRef struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IdAd           uint32 `protobuf:"varint,1,opt,name=id_ad,json=idAd,proto3" json:"id_ad,omitempty"`
+	DeleteOriginal bool   `protobuf:"varint,2,opt,name=delete_original,json=deleteOriginal,proto3" json:"delete_original,omitempty"`
+}
+
+func (x *AdRef) Reset() {
+	*x = AdRef{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AdRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdRef) ProtoMessage() {}
+
+func (x *AdRef) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdRef.ProtoReflect.Descriptor instead.
+func (*AdRef) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AdRef) GetIdAd() uint32 {
+	if x != nil {
+		return x.IdAd
+	}
+	return 0
+}
+
+func (x *AdRef) GetDeleteOriginal() bool {
+	if x != nil {
+		return x.DeleteOriginal
+	}
+	return false
+}
+
+// VariantSpec describes one resized variant. A spec that only has a name
+// refers to the server-side preset of that name. JPEG variants also get
+// siblings in modern formats, named e.g. "large-webp".
+type VariantSpec struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name      string      `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	MaxWidth  uint32      `protobuf:"varint,2,opt,name=max_width,json=maxWidth,proto3" json:"max_width,omitempty"`
+	MaxHeight uint32      `protobuf:"varint,3,opt,name=max_height,json=maxHeight,proto3" json:"max_height,omitempty"`
+	Fit       FitMode     `protobuf:"varint,4,opt,name=fit,proto3,enum=FitMode" json:"fit,omitempty"`
+	Format    ImageFormat `protobuf:"varint,5,opt,name=format,proto3,enum=ImageFormat" json:"format,omitempty"`
+	Quality   uint32      `protobuf:"varint,6,opt,name=quality,proto3" json:"quality,omitempty"`
+}
+
+func (x *VariantSpec) Reset() {
+	*x = VariantSpec{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VariantSpec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VariantSpec) ProtoMessage() {}
+
+func (x *VariantSpec) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VariantSpec.ProtoReflect.Descriptor instead.
+func (*VariantSpec) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *VariantSpec) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *VariantSpec) GetMaxWidth() uint32 {
+	if x != nil {
+		return x.MaxWidth
+	}
+	return 0
+}
+
+func (x *VariantSpec) GetMaxHeight() uint32 {
+	if x != nil {
+		return x.MaxHeight
+	}
+	return 0
+}
+
+func (x *VariantSpec) GetFit() FitMode {
+	if x != nil {
+		return x.Fit
+	}
+	return FitMode_FitContain
+}
+
+func (x *VariantSpec) GetFormat() ImageFormat {
+	if x != nil {
+		return x.Format
+	}
+	return ImageFormat_FormatOriginal
+}
+
+func (x *VariantSpec) GetQuality() uint32 {
+	if x != nil {
+		return x.Quality
+	}
+	return 0
+}
+
+// Status is returned by Process on success. Failed calls return a gRPC error
+// whose details carry a Status with the matching code.
 type Status struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -133,7 +479,7 @@ type Status struct {
 func (x *Status) Reset() {
 	*x = Status{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_pb_image_processor_proto_msgTypes[1]
+		mi := &file_pb_image_processor_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -146,7 +492,7 @@ func (x *Status) String() string {
 func (*Status) ProtoMessage() {}
 
 func (x *Status) ProtoReflect() protoreflect.Message {
-	mi := &file_pb_image_processor_proto_msgTypes[1]
+	mi := &file_pb_image_processor_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -159,7 +505,7 @@ func (x *Status) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Status.ProtoReflect.Descriptor instead.
 func (*Status) Descriptor() ([]byte, []int) {
-	return file_pb_image_processor_proto_rawDescGZIP(), []int{1}
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *Status) GetMessage() string {
@@ -176,77 +522,955 @@ func (x *Status) GetCode() StatusCode {
 	return StatusCode_Unknown
 }
 
-var File_pb_image_processor_proto protoreflect.FileDescriptor
+type VariantStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-var file_pb_image_processor_proto_rawDesc = []byte{
-	0x0a, 0x18, 0x70, 0x62, 0x2f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2d, 0x70, 0x72, 0x6f, 0x63, 0x65,
-	0x73, 0x73, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x17, 0x0a, 0x05, 0x49, 0x6d,
-	0x61, 0x67, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
-	0x02, 0x69, 0x64, 0x22, 0x43, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x18, 0x0a,
-	0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
-	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x43, 0x6f, 0x64, 0x65, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x6f,
-	0x64, 0x65, 0x52, 0x04, 0x43, 0x6f, 0x64, 0x65, 0x2a, 0x2d, 0x0a, 0x0a, 0x53, 0x74, 0x61, 0x74,
-	0x75, 0x73, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77,
-	0x6e, 0x10, 0x00, 0x12, 0x06, 0x0a, 0x02, 0x4f, 0x6b, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x46,
-	0x61, 0x69, 0x6c, 0x65, 0x64, 0x10, 0x02, 0x32, 0x35, 0x0a, 0x15, 0x49, 0x6d, 0x61, 0x67, 0x65,
-	0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x12, 0x1c, 0x0a, 0x07, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x12, 0x06, 0x2e, 0x49, 0x6d,
-	0x61, 0x67, 0x65, 0x1a, 0x07, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0x00, 0x42, 0x14,
-	0x5a, 0x12, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2d, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x6f,
-	0x72, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	Name        string          `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	State       ProcessingState `protobuf:"varint,2,opt,name=state,proto3,enum=ProcessingState" json:"state,omitempty"`
+	Url         string          `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
+	Width       uint32          `protobuf:"varint,4,opt,name=width,proto3" json:"width,omitempty"`
+	Height      uint32          `protobuf:"varint,5,opt,name=height,proto3" json:"height,omitempty"`
+	Backend     string          `protobuf:"bytes,6,opt,name=backend,proto3" json:"backend,omitempty"`
+	Attempts    uint32          `protobuf:"varint,7,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	LastError   string          `protobuf:"bytes,8,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	ContentType string          `protobuf:"bytes,9,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
 }
 
-var (
-	file_pb_image_processor_proto_rawDescOnce sync.Once
-	file_pb_image_processor_proto_rawDescData = file_pb_image_processor_proto_rawDesc
-)
+func (x *VariantStatus) Reset() {
+	*x = VariantStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
 
-func file_pb_image_processor_proto_rawDescGZIP() []byte {
-	file_pb_image_processor_proto_rawDescOnce.Do(func() {
-		file_pb_image_processor_proto_rawDescData = protoimpl.X.CompressGZIP(file_pb_image_processor_proto_rawDescData)
-	})
-	return file_pb_image_processor_proto_rawDescData
+func (x *VariantStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var file_pb_image_processor_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_pb_image_processor_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
-var file_pb_image_processor_proto_goTypes = []interface{}{
-	(StatusCode)(0), // 0: StatusCode
-	(*Image)(nil),   // 1: Image
-	(*Status)(nil),  // 2: Status
+func (*VariantStatus) ProtoMessage() {}
+
+func (x *VariantStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
-var file_pb_image_processor_proto_depIdxs = []int32{
-	0, // 0: Status.Code:type_name -> StatusCode
-	1, // 1: ImageProcessorService.Process:input_type -> Image
-	2, // 2: ImageProcessorService.Process:output_type -> Status
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+
+// Deprecated: Use VariantStatus.ProtoReflect.Descriptor instead.
+func (*VariantStatus) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{4}
 }
 
-func init() { file_pb_image_processor_proto_init() }
-func file_pb_image_processor_proto_init() {
-	if File_pb_image_processor_proto != nil {
-		return
+func (x *VariantStatus) GetName() string {
+	if x != nil {
+		return x.Name
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_pb_image_processor_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Image); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_pb_image_processor_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Status); i {
+	return ""
+}
+
+func (x *VariantStatus) GetState() ProcessingState {
+	if x != nil {
+		return x.State
+	}
+	return ProcessingState_ProcessingUnknown
+}
+
+func (x *VariantStatus) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *VariantStatus) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *VariantStatus) GetHeight() uint32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *VariantStatus) GetBackend() string {
+	if x != nil {
+		return x.Backend
+	}
+	return ""
+}
+
+func (x *VariantStatus) GetAttempts() uint32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *VariantStatus) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *VariantStatus) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+// PhotoStatus carries the state of every variant of a photo. blur_hash and
+// placeholder, a data URI of a tiny JPEG, are set once the original was
+// analyzed and can be shown until a variant is loaded.
+type PhotoStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id          uint32           `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Variants    []*VariantStatus `protobuf:"bytes,2,rep,name=variants,proto3" json:"variants,omitempty"`
+	BlurHash    string           `protobuf:"bytes,3,opt,name=blur_hash,json=blurHash,proto3" json:"blur_hash,omitempty"`
+	Placeholder string           `protobuf:"bytes,4,opt,name=placeholder,proto3" json:"placeholder,omitempty"`
+}
+
+func (x *PhotoStatus) Reset() {
+	*x = PhotoStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PhotoStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PhotoStatus) ProtoMessage() {}
+
+func (x *PhotoStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PhotoStatus.ProtoReflect.Descriptor instead.
+func (*PhotoStatus) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PhotoStatus) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *PhotoStatus) GetVariants() []*VariantStatus {
+	if x != nil {
+		return x.Variants
+	}
+	return nil
+}
+
+func (x *PhotoStatus) GetBlurHash() string {
+	if x != nil {
+		return x.BlurHash
+	}
+	return ""
+}
+
+func (x *PhotoStatus) GetPlaceholder() string {
+	if x != nil {
+		return x.Placeholder
+	}
+	return ""
+}
+
+type ProcessingEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id      uint32         `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Variant *VariantStatus `protobuf:"bytes,2,opt,name=variant,proto3" json:"variant,omitempty"`
+}
+
+func (x *ProcessingEvent) Reset() {
+	*x = ProcessingEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProcessingEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessingEvent) ProtoMessage() {}
+
+func (x *ProcessingEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessingEvent.ProtoReflect.Descriptor instead.
+func (*ProcessingEvent) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ProcessingEvent) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ProcessingEvent) GetVariant() *VariantStatus {
+	if x != nil {
+		return x.Variant
+	}
+	return nil
+}
+
+type Batch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ids      []uint32       `protobuf:"varint,1,rep,packed,name=ids,proto3" json:"ids,omitempty"`
+	IdAd     uint32         `protobuf:"varint,2,opt,name=id_ad,json=idAd,proto3" json:"id_ad,omitempty"`
+	Variants []*VariantSpec `protobuf:"bytes,3,rep,name=variants,proto3" json:"variants,omitempty"`
+}
+
+func (x *Batch) Reset() {
+	*x = Batch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Batch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Batch) ProtoMessage() {}
+
+func (x *Batch) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Batch.ProtoReflect.Descriptor instead.
+func (*Batch) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Batch) GetIds() []uint32 {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+func (x *Batch) GetIdAd() uint32 {
+	if x != nil {
+		return x.IdAd
+	}
+	return 0
+}
+
+func (x *Batch) GetVariants() []*VariantSpec {
+	if x != nil {
+		return x.Variants
+	}
+	return nil
+}
+
+type PhotoResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id       uint32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Accepted bool   `protobuf:"varint,2,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Reason   string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *PhotoResult) Reset() {
+	*x = PhotoResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PhotoResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PhotoResult) ProtoMessage() {}
+
+func (x *PhotoResult) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PhotoResult.ProtoReflect.Descriptor instead.
+func (*PhotoResult) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PhotoResult) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *PhotoResult) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+func (x *PhotoResult) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type BatchResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Results []*PhotoResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+}
+
+func (x *BatchResult) Reset() {
+	*x = BatchResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResult) ProtoMessage() {}
+
+func (x *BatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResult.ProtoReflect.Descriptor instead.
+func (*BatchResult) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *BatchResult) GetResults() []*PhotoResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// SimilarRequest asks for the photos of other ads within max_distance bits,
+// at most 11, of the photo's perceptual hash. Photos whose original was not
+// analyzed yet fail with NotReady. limit defaults to 100.
+type SimilarRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id          uint32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	MaxDistance uint32 `protobuf:"varint,2,opt,name=max_distance,json=maxDistance,proto3" json:"max_distance,omitempty"`
+	Limit       uint32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (x *SimilarRequest) Reset() {
+	*x = SimilarRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SimilarRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimilarRequest) ProtoMessage() {}
+
+func (x *SimilarRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimilarRequest.ProtoReflect.Descriptor instead.
+func (*SimilarRequest) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SimilarRequest) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *SimilarRequest) GetMaxDistance() uint32 {
+	if x != nil {
+		return x.MaxDistance
+	}
+	return 0
+}
+
+func (x *SimilarRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type SimilarPhoto struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id       uint32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	IdAd     uint32 `protobuf:"varint,2,opt,name=id_ad,json=idAd,proto3" json:"id_ad,omitempty"`
+	Distance uint32 `protobuf:"varint,3,opt,name=distance,proto3" json:"distance,omitempty"`
+}
+
+func (x *SimilarPhoto) Reset() {
+	*x = SimilarPhoto{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SimilarPhoto) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimilarPhoto) ProtoMessage() {}
+
+func (x *SimilarPhoto) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimilarPhoto.ProtoReflect.Descriptor instead.
+func (*SimilarPhoto) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SimilarPhoto) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *SimilarPhoto) GetIdAd() uint32 {
+	if x != nil {
+		return x.IdAd
+	}
+	return 0
+}
+
+func (x *SimilarPhoto) GetDistance() uint32 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+// SimilarPhotos are ordered by distance, closest first.
+type SimilarPhotos struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Photos []*SimilarPhoto `protobuf:"bytes,1,rep,name=photos,proto3" json:"photos,omitempty"`
+}
+
+func (x *SimilarPhotos) Reset() {
+	*x = SimilarPhotos{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_image_processor_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SimilarPhotos) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimilarPhotos) ProtoMessage() {}
+
+func (x *SimilarPhotos) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_image_processor_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimilarPhotos.ProtoReflect.Descriptor instead.
+func (*SimilarPhotos) Descriptor() ([]byte, []int) {
+	return file_pb_image_processor_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SimilarPhotos) GetPhotos() []*SimilarPhoto {
+	if x != nil {
+		return x.Photos
+	}
+	return nil
+}
+
+var File_pb_image_processor_proto protoreflect.FileDescriptor
+
+var file_pb_image_processor_proto_rawDesc = []byte{
+	0x0a, 0x18, 0x70, 0x62, 0x2f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2d, 0x70, 0x72, 0x6f, 0x63, 0x65,
+	0x73, 0x73, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x6a, 0x0a, 0x05, 0x49, 0x6d,
+	0x61, 0x67, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x02, 0x69, 0x64, 0x12, 0x28, 0x0a, 0x08, 0x76, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x73, 0x18,
+	0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x53,
+	0x70, 0x65, 0x63, 0x52, 0x08, 0x76, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x73, 0x12, 0x27, 0x0a,
+	0x0f, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x5f, 0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4f, 0x72,
+	0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c, 0x22, 0x45, 0x0a, 0x05, 0x41, 0x64, 0x52, 0x65, 0x66, 0x12,
+	0x13, 0x0a, 0x05, 0x69, 0x64, 0x5f, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04,
+	0x69, 0x64, 0x41, 0x64, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x5f, 0x6f,
+	0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x64,
+	0x65, 0x6c, 0x65, 0x74, 0x65, 0x4f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c, 0x22, 0xb9, 0x01,
+	0x0a, 0x0b, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x53, 0x70, 0x65, 0x63, 0x12, 0x12, 0x0a,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6d, 0x61, 0x78, 0x5f, 0x77, 0x69, 0x64, 0x74, 0x68, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x6d, 0x61, 0x78, 0x57, 0x69, 0x64, 0x74, 0x68, 0x12, 0x1d,
+	0x0a, 0x0a, 0x6d, 0x61, 0x78, 0x5f, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x09, 0x6d, 0x61, 0x78, 0x48, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x1a, 0x0a,
+	0x03, 0x66, 0x69, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x08, 0x2e, 0x46, 0x69, 0x74,
+	0x4d, 0x6f, 0x64, 0x65, 0x52, 0x03, 0x66, 0x69, 0x74, 0x12, 0x24, 0x0a, 0x06, 0x66, 0x6f, 0x72,
+	0x6d, 0x61, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0c, 0x2e, 0x49, 0x6d, 0x61, 0x67,
+	0x65, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x52, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12,
+	0x18, 0x0a, 0x07, 0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x07, 0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x22, 0x43, 0x0a, 0x06, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1f, 0x0a,
+	0x04, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b, 0x2e, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x43, 0x6f, 0x64, 0x65, 0x22, 0x83,
+	0x02, 0x0a, 0x0d, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x26, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x10, 0x2e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67,
+	0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x10, 0x0a, 0x03,
+	0x75, 0x72, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x12, 0x14,
+	0x0a, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x77,
+	0x69, 0x64, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x18, 0x0a, 0x07,
+	0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x62,
+	0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70,
+	0x74, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70,
+	0x74, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x61, 0x73, 0x74, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72,
+	0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x45, 0x72, 0x72, 0x6f,
+	0x72, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70,
+	0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74,
+	0x54, 0x79, 0x70, 0x65, 0x22, 0x88, 0x01, 0x0a, 0x0b, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x02, 0x69, 0x64, 0x12, 0x2a, 0x0a, 0x08, 0x76, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x73,
+	0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x08, 0x76, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x73,
+	0x12, 0x1b, 0x0a, 0x09, 0x62, 0x6c, 0x75, 0x72, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x08, 0x62, 0x6c, 0x75, 0x72, 0x48, 0x61, 0x73, 0x68, 0x12, 0x20, 0x0a,
+	0x0b, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x68, 0x6f, 0x6c, 0x64, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0b, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x68, 0x6f, 0x6c, 0x64, 0x65, 0x72, 0x22,
+	0x4b, 0x0a, 0x0f, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x45, 0x76, 0x65,
+	0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02,
+	0x69, 0x64, 0x12, 0x28, 0x0a, 0x07, 0x76, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x52, 0x07, 0x76, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x22, 0x58, 0x0a, 0x05,
+	0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x10, 0x0a, 0x03, 0x69, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x0d, 0x52, 0x03, 0x69, 0x64, 0x73, 0x12, 0x13, 0x0a, 0x05, 0x69, 0x64, 0x5f, 0x61, 0x64,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x69, 0x64, 0x41, 0x64, 0x12, 0x28, 0x0a, 0x08,
+	0x76, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c,
+	0x2e, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74, 0x53, 0x70, 0x65, 0x63, 0x52, 0x08, 0x76, 0x61,
+	0x72, 0x69, 0x61, 0x6e, 0x74, 0x73, 0x22, 0x51, 0x0a, 0x0b, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x52,
+	0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x65,
+	0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x65,
+	0x64, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x35, 0x0a, 0x0b, 0x42, 0x61, 0x74,
+	0x63, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x26, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x50, 0x68, 0x6f, 0x74,
+	0x6f, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x52, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73,
+	0x22, 0x59, 0x0a, 0x0e, 0x53, 0x69, 0x6d, 0x69, 0x6c, 0x61, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02,
+	0x69, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x61, 0x78, 0x5f, 0x64, 0x69, 0x73, 0x74, 0x61, 0x6e,
+	0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x6d, 0x61, 0x78, 0x44, 0x69, 0x73,
+	0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x22, 0x4f, 0x0a, 0x0c, 0x53,
+	0x69, 0x6d, 0x69, 0x6c, 0x61, 0x72, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x12, 0x0e, 0x0a, 0x02, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x13, 0x0a, 0x05, 0x69,
+	0x64, 0x5f, 0x61, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x69, 0x64, 0x41, 0x64,
+	0x12, 0x1a, 0x0a, 0x08, 0x64, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x08, 0x64, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x22, 0x36, 0x0a, 0x0d,
+	0x53, 0x69, 0x6d, 0x69, 0x6c, 0x61, 0x72, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x73, 0x12, 0x25, 0x0a,
+	0x06, 0x70, 0x68, 0x6f, 0x74, 0x6f, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d, 0x2e,
+	0x53, 0x69, 0x6d, 0x69, 0x6c, 0x61, 0x72, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x52, 0x06, 0x70, 0x68,
+	0x6f, 0x74, 0x6f, 0x73, 0x2a, 0x35, 0x0a, 0x07, 0x46, 0x69, 0x74, 0x4d, 0x6f, 0x64, 0x65, 0x12,
+	0x0e, 0x0a, 0x0a, 0x46, 0x69, 0x74, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x10, 0x00, 0x12,
+	0x0c, 0x0a, 0x08, 0x46, 0x69, 0x74, 0x43, 0x6f, 0x76, 0x65, 0x72, 0x10, 0x01, 0x12, 0x0c, 0x0a,
+	0x08, 0x46, 0x69, 0x74, 0x45, 0x78, 0x61, 0x63, 0x74, 0x10, 0x02, 0x2a, 0x60, 0x0a, 0x0b, 0x49,
+	0x6d, 0x61, 0x67, 0x65, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x12, 0x0a, 0x0e, 0x46, 0x6f,
+	0x72, 0x6d, 0x61, 0x74, 0x4f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c, 0x10, 0x00, 0x12, 0x0e,
+	0x0a, 0x0a, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x4a, 0x70, 0x65, 0x67, 0x10, 0x01, 0x12, 0x0d,
+	0x0a, 0x09, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x50, 0x6e, 0x67, 0x10, 0x02, 0x12, 0x0e, 0x0a,
+	0x0a, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x57, 0x65, 0x62, 0x70, 0x10, 0x03, 0x12, 0x0e, 0x0a,
+	0x0a, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x41, 0x76, 0x69, 0x66, 0x10, 0x04, 0x2a, 0x86, 0x01,
+	0x0a, 0x0a, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x0b, 0x0a, 0x07,
+	0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x10, 0x00, 0x12, 0x06, 0x0a, 0x02, 0x4f, 0x6b, 0x10,
+	0x01, 0x12, 0x0a, 0x0a, 0x06, 0x46, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x10, 0x02, 0x12, 0x0c, 0x0a,
+	0x08, 0x4e, 0x6f, 0x74, 0x46, 0x6f, 0x75, 0x6e, 0x64, 0x10, 0x03, 0x12, 0x13, 0x0a, 0x0f, 0x49,
+	0x6e, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x41, 0x72, 0x67, 0x75, 0x6d, 0x65, 0x6e, 0x74, 0x10, 0x04,
+	0x12, 0x0f, 0x0a, 0x0b, 0x55, 0x6e, 0x61, 0x76, 0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65, 0x10,
+	0x05, 0x12, 0x15, 0x0a, 0x11, 0x41, 0x6c, 0x72, 0x65, 0x61, 0x64, 0x79, 0x50, 0x72, 0x6f, 0x63,
+	0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x10, 0x06, 0x12, 0x0c, 0x0a, 0x08, 0x4e, 0x6f, 0x74, 0x52,
+	0x65, 0x61, 0x64, 0x79, 0x10, 0x07, 0x2a, 0xaf, 0x01, 0x0a, 0x0f, 0x50, 0x72, 0x6f, 0x63, 0x65,
+	0x73, 0x73, 0x69, 0x6e, 0x67, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x15, 0x0a, 0x11, 0x50, 0x72,
+	0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x10,
+	0x00, 0x12, 0x14, 0x0a, 0x10, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x51,
+	0x75, 0x65, 0x75, 0x65, 0x64, 0x10, 0x01, 0x12, 0x15, 0x0a, 0x11, 0x50, 0x72, 0x6f, 0x63, 0x65,
+	0x73, 0x73, 0x69, 0x6e, 0x67, 0x52, 0x75, 0x6e, 0x6e, 0x69, 0x6e, 0x67, 0x10, 0x02, 0x12, 0x17,
+	0x0a, 0x13, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x53, 0x75, 0x63, 0x63,
+	0x65, 0x65, 0x64, 0x65, 0x64, 0x10, 0x03, 0x12, 0x14, 0x0a, 0x10, 0x50, 0x72, 0x6f, 0x63, 0x65,
+	0x73, 0x73, 0x69, 0x6e, 0x67, 0x46, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x10, 0x04, 0x12, 0x12, 0x0a,
+	0x0e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x61, 0x64, 0x10,
+	0x05, 0x12, 0x15, 0x0a, 0x11, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x49,
+	0x6e, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x10, 0x06, 0x32, 0xa6, 0x02, 0x0a, 0x15, 0x49, 0x6d, 0x61,
+	0x67, 0x65, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x12, 0x1c, 0x0a, 0x07, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x12, 0x06, 0x2e,
+	0x49, 0x6d, 0x61, 0x67, 0x65, 0x1a, 0x07, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0x00,
+	0x12, 0x23, 0x0a, 0x09, 0x47, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x06, 0x2e,
+	0x49, 0x6d, 0x61, 0x67, 0x65, 0x1a, 0x0c, 0x2e, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x22, 0x00, 0x12, 0x2f, 0x0a, 0x0f, 0x57, 0x61, 0x74, 0x63, 0x68, 0x50, 0x72,
+	0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x12, 0x06, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65,
+	0x1a, 0x10, 0x2e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x45, 0x76, 0x65,
+	0x6e, 0x74, 0x22, 0x00, 0x30, 0x01, 0x12, 0x26, 0x0a, 0x0c, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73,
+	0x73, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x06, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x1a, 0x0c,
+	0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x30,
+	0x0a, 0x0b, 0x46, 0x69, 0x6e, 0x64, 0x53, 0x69, 0x6d, 0x69, 0x6c, 0x61, 0x72, 0x12, 0x0f, 0x2e,
+	0x53, 0x69, 0x6d, 0x69, 0x6c, 0x61, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0e,
+	0x2e, 0x53, 0x69, 0x6d, 0x69, 0x6c, 0x61, 0x72, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x73, 0x22, 0x00,
+	0x12, 0x20, 0x0a, 0x0b, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x50, 0x68, 0x6f, 0x74, 0x6f, 0x12,
+	0x06, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x1a, 0x07, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x22, 0x00, 0x12, 0x1d, 0x0a, 0x08, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x41, 0x64, 0x12, 0x06,
+	0x2e, 0x41, 0x64, 0x52, 0x65, 0x66, 0x1a, 0x07, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22,
+	0x00, 0x42, 0x14, 0x5a, 0x12, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2d, 0x70, 0x72, 0x6f, 0x63, 0x65,
+	0x73, 0x73, 0x6f, 0x72, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_pb_image_processor_proto_rawDescOnce sync.Once
+	file_pb_image_processor_proto_rawDescData = file_pb_image_processor_proto_rawDesc
+)
+
+func file_pb_image_processor_proto_rawDescGZIP() []byte {
+	file_pb_image_processor_proto_rawDescOnce.Do(func() {
+		file_pb_image_processor_proto_rawDescData = protoimpl.X.CompressGZIP(file_pb_image_processor_proto_rawDescData)
+	})
+	return file_pb_image_processor_proto_rawDescData
+}
+
+var file_pb_image_processor_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_pb_image_processor_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_pb_image_processor_proto_goTypes = []interface{}{
+	(FitMode)(0),            // 0: FitMode
+	(ImageFormat)(0),        // 1: ImageFormat
+	(StatusCode)(0),         // 2: StatusCode
+	(ProcessingState)(0),    // 3: ProcessingState
+	(*Image)(nil),           // 4: Image
+	(*AdRef)(nil),           // 5: AdRef
+	(*VariantSpec)(nil),     // 6: VariantSpec
+	(*Status)(nil),          // 7: Status
+	(*VariantStatus)(nil),   // 8: VariantStatus
+	(*PhotoStatus)(nil),     // 9: PhotoStatus
+	(*ProcessingEvent)(nil), // 10: ProcessingEvent
+	(*Batch)(nil),           // 11: Batch
+	(*PhotoResult)(nil),     // 12: PhotoResult
+	(*BatchResult)(nil),     // 13: BatchResult
+	(*SimilarRequest)(nil),  // 14: SimilarRequest
+	(*SimilarPhoto)(nil),    // 15: SimilarPhoto
+	(*SimilarPhotos)(nil),   // 16: SimilarPhotos
+}
+var file_pb_image_processor_proto_depIdxs = []int32{
+	6,  // 0: Image.variants:type_name -> VariantSpec
+	0,  // 1: VariantSpec.fit:type_name -> FitMode
+	1,  // 2: VariantSpec.format:type_name -> ImageFormat
+	2,  // 3: Status.Code:type_name -> StatusCode
+	3,  // 4: VariantStatus.state:type_name -> ProcessingState
+	8,  // 5: PhotoStatus.variants:type_name -> VariantStatus
+	8,  // 6: ProcessingEvent.variant:type_name -> VariantStatus
+	6,  // 7: Batch.variants:type_name -> VariantSpec
+	12, // 8: BatchResult.results:type_name -> PhotoResult
+	15, // 9: SimilarPhotos.photos:type_name -> SimilarPhoto
+	4,  // 10: ImageProcessorService.Process:input_type -> Image
+	4,  // 11: ImageProcessorService.GetStatus:input_type -> Image
+	4,  // 12: ImageProcessorService.WatchProcessing:input_type -> Image
+	11, // 13: ImageProcessorService.ProcessBatch:input_type -> Batch
+	14, // 14: ImageProcessorService.FindSimilar:input_type -> SimilarRequest
+	4,  // 15: ImageProcessorService.DeletePhoto:input_type -> Image
+	5,  // 16: ImageProcessorService.DeleteAd:input_type -> AdRef
+	7,  // 17: ImageProcessorService.Process:output_type -> Status
+	9,  // 18: ImageProcessorService.GetStatus:output_type -> PhotoStatus
+	10, // 19: ImageProcessorService.WatchProcessing:output_type -> ProcessingEvent
+	13, // 20: ImageProcessorService.ProcessBatch:output_type -> BatchResult
+	16, // 21: ImageProcessorService.FindSimilar:output_type -> SimilarPhotos
+	7,  // 22: ImageProcessorService.DeletePhoto:output_type -> Status
+	7,  // 23: ImageProcessorService.DeleteAd:output_type -> Status
+	17, // [17:24] is the sub-list for method output_type
+	10, // [10:17] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_pb_image_processor_proto_init() }
+func file_pb_image_processor_proto_init() {
+	if File_pb_image_processor_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_pb_image_processor_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Image); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AdRef); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VariantSpec); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Status); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VariantStatus); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PhotoStatus); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProcessingEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Batch); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PhotoResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SimilarRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SimilarPhoto); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_image_processor_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SimilarPhotos); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -263,8 +1487,8 @@ func file_pb_image_processor_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_pb_image_processor_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   2,
+			NumEnums:      4,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
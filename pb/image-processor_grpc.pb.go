@@ -18,6 +18,14 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ImageProcessorServiceClient interface {
 	Process(ctx context.Context, in *Image, opts ...grpc.CallOption) (*Status, error)
+	GetStatus(ctx context.Context, in *Image, opts ...grpc.CallOption) (*PhotoStatus, error)
+	WatchProcessing(ctx context.Context, in *Image, opts ...grpc.CallOption) (ImageProcessorService_WatchProcessingClient, error)
+	ProcessBatch(ctx context.Context, in *Batch, opts ...grpc.CallOption) (*BatchResult, error)
+	FindSimilar(ctx context.Context, in *SimilarRequest, opts ...grpc.CallOption) (*SimilarPhotos, error)
+	// DeletePhoto and DeleteAd delete photos right away and remove their
+	// variants from storage in the background, retrying until it succeeded.
+	DeletePhoto(ctx context.Context, in *Image, opts ...grpc.CallOption) (*Status, error)
+	DeleteAd(ctx context.Context, in *AdRef, opts ...grpc.CallOption) (*Status, error)
 }
 
 type imageProcessorServiceClient struct {
@@ -37,11 +45,96 @@ func (c *imageProcessorServiceClient) Process(ctx context.Context, in *Image, op
 	return out, nil
 }
 
+func (c *imageProcessorServiceClient) GetStatus(ctx context.Context, in *Image, opts ...grpc.CallOption) (*PhotoStatus, error) {
+	out := new(PhotoStatus)
+	err := c.cc.Invoke(ctx, "/ImageProcessorService/GetStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorServiceClient) WatchProcessing(ctx context.Context, in *Image, opts ...grpc.CallOption) (ImageProcessorService_WatchProcessingClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ImageProcessorService_serviceDesc.Streams[0], "/ImageProcessorService/WatchProcessing", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &imageProcessorServiceWatchProcessingClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ImageProcessorService_WatchProcessingClient interface {
+	Recv() (*ProcessingEvent, error)
+	grpc.ClientStream
+}
+
+type imageProcessorServiceWatchProcessingClient struct {
+	grpc.ClientStream
+}
+
+func (x *imageProcessorServiceWatchProcessingClient) Recv() (*ProcessingEvent, error) {
+	m := new(ProcessingEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *imageProcessorServiceClient) ProcessBatch(ctx context.Context, in *Batch, opts ...grpc.CallOption) (*BatchResult, error) {
+	out := new(BatchResult)
+	err := c.cc.Invoke(ctx, "/ImageProcessorService/ProcessBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorServiceClient) FindSimilar(ctx context.Context, in *SimilarRequest, opts ...grpc.CallOption) (*SimilarPhotos, error) {
+	out := new(SimilarPhotos)
+	err := c.cc.Invoke(ctx, "/ImageProcessorService/FindSimilar", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorServiceClient) DeletePhoto(ctx context.Context, in *Image, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/ImageProcessorService/DeletePhoto", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorServiceClient) DeleteAd(ctx context.Context, in *AdRef, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/ImageProcessorService/DeleteAd", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ImageProcessorServiceServer is the server API for ImageProcessorService service.
 // All implementations must embed UnimplementedImageProcessorServiceServer
 // for forward compatibility
 type ImageProcessorServiceServer interface {
 	Process(context.Context, *Image) (*Status, error)
+	GetStatus(context.Context, *Image) (*PhotoStatus, error)
+	WatchProcessing(*Image, ImageProcessorService_WatchProcessingServer) error
+	ProcessBatch(context.Context, *Batch) (*BatchResult, error)
+	FindSimilar(context.Context, *SimilarRequest) (*SimilarPhotos, error)
+	// DeletePhoto and DeleteAd delete photos right away and remove their
+	// variants from storage in the background, retrying until it succeeded.
+	DeletePhoto(context.Context, *Image) (*Status, error)
+	DeleteAd(context.Context, *AdRef) (*Status, error)
 	mustEmbedUnimplementedImageProcessorServiceServer()
 }
 
@@ -52,6 +145,24 @@ type UnimplementedImageProcessorServiceServer struct {
 func (UnimplementedImageProcessorServiceServer) Process(context.Context, *Image) (*Status, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Process not implemented")
 }
+func (UnimplementedImageProcessorServiceServer) GetStatus(context.Context, *Image) (*PhotoStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedImageProcessorServiceServer) WatchProcessing(*Image, ImageProcessorService_WatchProcessingServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchProcessing not implemented")
+}
+func (UnimplementedImageProcessorServiceServer) ProcessBatch(context.Context, *Batch) (*BatchResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ProcessBatch not implemented")
+}
+func (UnimplementedImageProcessorServiceServer) FindSimilar(context.Context, *SimilarRequest) (*SimilarPhotos, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindSimilar not implemented")
+}
+func (UnimplementedImageProcessorServiceServer) DeletePhoto(context.Context, *Image) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeletePhoto not implemented")
+}
+func (UnimplementedImageProcessorServiceServer) DeleteAd(context.Context, *AdRef) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAd not implemented")
+}
 func (UnimplementedImageProcessorServiceServer) mustEmbedUnimplementedImageProcessorServiceServer() {}
 
 // UnsafeImageProcessorServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -83,6 +194,117 @@ func _ImageProcessorService_Process_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ImageProcessorService_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Image)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServiceServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ImageProcessorService/GetStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServiceServer).GetStatus(ctx, req.(*Image))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessorService_WatchProcessing_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Image)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageProcessorServiceServer).WatchProcessing(m, &imageProcessorServiceWatchProcessingServer{stream})
+}
+
+type ImageProcessorService_WatchProcessingServer interface {
+	Send(*ProcessingEvent) error
+	grpc.ServerStream
+}
+
+type imageProcessorServiceWatchProcessingServer struct {
+	grpc.ServerStream
+}
+
+func (x *imageProcessorServiceWatchProcessingServer) Send(m *ProcessingEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ImageProcessorService_ProcessBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Batch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServiceServer).ProcessBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ImageProcessorService/ProcessBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServiceServer).ProcessBatch(ctx, req.(*Batch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessorService_FindSimilar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SimilarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServiceServer).FindSimilar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ImageProcessorService/FindSimilar",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServiceServer).FindSimilar(ctx, req.(*SimilarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessorService_DeletePhoto_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Image)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServiceServer).DeletePhoto(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ImageProcessorService/DeletePhoto",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServiceServer).DeletePhoto(ctx, req.(*Image))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessorService_DeleteAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServiceServer).DeleteAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ImageProcessorService/DeleteAd",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServiceServer).DeleteAd(ctx, req.(*AdRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _ImageProcessorService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "ImageProcessorService",
 	HandlerType: (*ImageProcessorServiceServer)(nil),
@@ -91,7 +313,33 @@ var _ImageProcessorService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Process",
 			Handler:    _ImageProcessorService_Process_Handler,
 		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _ImageProcessorService_GetStatus_Handler,
+		},
+		{
+			MethodName: "ProcessBatch",
+			Handler:    _ImageProcessorService_ProcessBatch_Handler,
+		},
+		{
+			MethodName: "FindSimilar",
+			Handler:    _ImageProcessorService_FindSimilar_Handler,
+		},
+		{
+			MethodName: "DeletePhoto",
+			Handler:    _ImageProcessorService_DeletePhoto_Handler,
+		},
+		{
+			MethodName: "DeleteAd",
+			Handler:    _ImageProcessorService_DeleteAd_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchProcessing",
+			Handler:       _ImageProcessorService_WatchProcessing_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "pb/image-processor.proto",
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Photos are hashed with a difference hash (dHash): the original is reduced
+// to 9x8 grey pixels and every bit tells whether a pixel is brighter than its
+// right neighbour. Re-encoded, resized or slightly edited copies of a photo
+// get hashes a small Hamming distance apart.
+//
+// To find similar hashes without scanning every photo the hash is also stored
+// split into four 16 bit bands, each with its own index. Two hashes within
+// distance d have at least one band within distance d/4, so candidates are
+// looked up by enumerating the band values within that radius and only then
+// compared in full, by the database.
+
+const (
+	hashBands     = 4
+	hashBandWidth = 64 / hashBands
+
+	// maxSimilarDistance bounds FindSimilar's distance. Above it every band
+	// needs a radius of 3 and the candidates no longer fit an index lookup.
+	maxSimilarDistance  = 11
+	defaultSimilarLimit = 100
+	maxSimilarLimit     = 1000
+)
+
+// SimilarPhoto is a photo whose original looks like the one searched for.
+type SimilarPhoto struct {
+	Id       uint32
+	IdAd     uint32
+	Distance int
+}
+
+// differenceHash returns the 64 bit dHash of img.
+func differenceHash(img image.Image) uint64 {
+	small := scale(img, img.Bounds(), 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := color.GrayModel.Convert(small.At(x, y)).(color.Gray).Y
+			right := color.GrayModel.Convert(small.At(x+1, y)).(color.Gray).Y
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// splitHash returns the bands of hash, lowest bits first.
+func splitHash(hash uint64) [hashBands]int32 {
+	var bands [hashBands]int32
+	for i := range bands {
+		bands[i] = int32(hash >> (i * hashBandWidth) & (1<<hashBandWidth - 1))
+	}
+	return bands
+}
+
+// bandNeighbours returns all band values within Hamming distance radius of
+// band, band itself included.
+func bandNeighbours(band int32, radius int) []int32 {
+	neighbours := []int32{band}
+	var flip func(value int32, from int, left int)
+	flip = func(value int32, from int, left int) {
+		for bit := from; bit < hashBandWidth; bit++ {
+			flipped := value ^ 1<<bit
+			neighbours = append(neighbours, flipped)
+			if left > 1 {
+				flip(flipped, bit+1, left-1)
+			}
+		}
+	}
+	if radius > 0 {
+		flip(band, 0, radius)
+	}
+	return neighbours
+}
+
+// hashDistance is the SQL expression of the Hamming distance between a
+// photo's hash and the hash given as its argument. Counting the ones of the
+// bit string works on every supported PostgreSQL version, bit_count needs 14.
+const hashDistance = "length(replace((perceptual_hash # ?)::bit(64)::text, '0', ''))"
+
+// findSimilarPhotos returns up to limit analyzed photos of other ads than
+// idAd whose hash is within maxDistance of hash, closest first. Candidates
+// are looked up by their bands and compared, sorted and limited in the
+// database.
+func findSimilarPhotos(db *gorm.DB, hash uint64, idAd uint, maxDistance int, limit int) ([]SimilarPhoto, error) {
+	radius := maxDistance / hashBands
+	var conditions []string
+	var values []interface{}
+	for i, band := range splitHash(hash) {
+		conditions = append(conditions, fmt.Sprintf("hash_band%d IN ?", i))
+		values = append(values, bandNeighbours(band, radius))
+	}
+	var similar []SimilarPhoto
+	err := db.Model(&Photo{}).
+		Select("id_photo AS id, id_ad, "+hashDistance+" AS distance", int64(hash)).
+		Where("("+strings.Join(conditions, " OR ")+")", values...).
+		Where("id_ad <> ?", idAd).
+		Where(hashDistance+" <= ?", int64(hash), maxDistance).
+		Order("distance, id_photo").
+		Limit(limit).
+		Scan(&similar).Error
+	return similar, err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+)
+
+type requestIdKey struct{}
+
+// RequestIdFromContext returns the request id stored by the request id
+// interceptors, or an empty string.
+func RequestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+func withRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// requestId takes the request id from the request-id or x-request-id
+// metadata of an incoming call and generates one when the client sent none.
+func requestId(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, key := range []string{"request-id", "x-request-id"} {
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return newRequestId()
+}
+
+// newRequestId returns a random (version 4) UUID.
+func newRequestId() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// UnaryRequestIdInterceptor stores the request id in the context of unary
+// calls and echoes it in the response headers.
+func UnaryRequestIdInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := requestId(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs("request-id", id))
+	return handler(withRequestId(ctx, id), req)
+}
+
+// StreamRequestIdInterceptor does the same as UnaryRequestIdInterceptor for
+// streaming calls.
+func StreamRequestIdInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id := requestId(stream.Context())
+	stream.SetHeader(metadata.Pairs("request-id", id))
+	return handler(srv, &requestIdStream{ServerStream: stream, ctx: withRequestId(stream.Context(), id)})
+}
+
+type requestIdStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *requestIdStream) Context() context.Context {
+	return stream.ctx
+}
+
+// setRequestIdHeader forwards the request id of req's context to outbound
+// HTTP calls.
+func setRequestIdHeader(req *http.Request) {
+	if id := RequestIdFromContext(req.Context()); id != "" {
+		req.Header.Set("X-Request-Id", id)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"image"
+	"strings"
+)
+
+// ResizeSpec describes the variant a Resizer has to produce. A zero Width
+// or Height leaves that side unconstrained for FitContain, a zero Quality
+// selects the backend's default.
+type ResizeSpec struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// ErrUnsupportedSpec is returned by backends that can not produce the
+// requested variant, so that the next backend of the chain is tried.
+var ErrUnsupportedSpec = errors.New("variant spec not supported by this backend")
+
+// ResizeSource is the original image, given either by URL or as raw bytes.
+// Backends that can only work with one of the two return an error when it
+// is missing. Orientation is the EXIF orientation of the original, which
+// backends have to apply to the variant; backends that can not return
+// ErrUnsupportedSpec for orientations other than 1. Image is the decoded
+// original when it was validated, so in-process backends need not decode it
+// again.
+type ResizeSource struct {
+	Url         string
+	Data        []byte
+	Orientation int
+	Image       image.Image
+}
+
+// ResizeResult is the output of a Resizer. Backends return the encoded
+// image in Data, which the service strips of metadata and uploads to
+// storage.
+type ResizeResult struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	Backend     string
+}
+
+type Resizer interface {
+	Name() string
+	// Formats returns the formats the backend can convert to, besides
+	// keeping the original one.
+	Formats() []string
+	Resize(ctx context.Context, source ResizeSource, spec ResizeSpec) (*ResizeResult, error)
+}
+
+const defaultResizeBackends = "kraken,imageresizer,local"
+
+// MakeResizers builds the resizer chain from a comma separated list of
+// backend names, e.g. "kraken,imageresizer,local". The service tries the
+// backends in the given order until one of them succeeds.
+func MakeResizers(backends string, fetcher *Fetcher, m *Metrics) ([]Resizer, error) {
+	viper.AutomaticEnv()
+	if strings.TrimSpace(backends) == "" {
+		backends = defaultResizeBackends
+	}
+
+	var resizers []Resizer
+	for _, name := range strings.Split(backends, ",") {
+		switch strings.TrimSpace(name) {
+		case "kraken":
+			resizers = append(resizers, NewKrakenResizer(viper.GetString("KRAKEN_API_KEY"), viper.GetString("KRAKEN_API_SECRET"), m.DownloadLatency))
+		case "imageresizer":
+			resizers = append(resizers, NewImageresizerResizer(viper.GetString("IMAGERESIZER_API_KEY"), m.DownloadLatency))
+		case "local":
+			resizers = append(resizers, NewLocalResizer(fetcher))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown resize backend %q", name)
+		}
+	}
+	if len(resizers) == 0 {
+		return nil, fmt.Errorf("no resize backend configured")
+	}
+	return resizers, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"strings"
+)
+
+// s3Store talks to S3-compatible APIs such as MinIO.
+type s3Store struct {
+	client    *minio.Client
+	bucket    string
+	publicUrl string
+}
+
+func NewS3Store(endpoint string, accessKey string, secretKey string, useSSL bool, bucket string, publicUrl string) (ObjectStore, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if publicUrl == "" {
+		publicUrl = fmt.Sprintf("%s/%s", client.EndpointURL(), bucket)
+	}
+	return &s3Store{
+		client:    client,
+		bucket:    bucket,
+		publicUrl: strings.TrimSuffix(publicUrl, "/"),
+	}, nil
+}
+
+func (store s3Store) Put(ctx context.Context, key string, reader io.Reader, opts PutOptions) error {
+	size := opts.Size
+	if size <= 0 {
+		size = -1
+	}
+	_, err := store.client.PutObject(ctx, store.bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		CacheControl: opts.CacheControl,
+	})
+	return err
+}
+
+func (store s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if _, err := store.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+	return store.client.GetObject(ctx, store.bucket, key, minio.GetObjectOptions{})
+}
+
+func (store s3Store) Delete(ctx context.Context, key string) error {
+	if _, err := store.Stat(ctx, key); err != nil {
+		return err
+	}
+	return store.client.RemoveObject(ctx, store.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (store s3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := store.client.StatObject(ctx, store.bucket, key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		Updated:     info.LastModified,
+	}, nil
+}
+
+func (store s3Store) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// Cancelling stops the listing goroutine when fn fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objects := store.client.ListObjects(ctx, store.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+	for object := range objects {
+		if object.Err != nil {
+			return object.Err
+		}
+		err := fn(ObjectInfo{
+			Key:         object.Key,
+			Size:        object.Size,
+			ContentType: object.ContentType,
+			Updated:     object.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (store s3Store) URL(key string) string {
+	return store.publicUrl + "/" + key
+}
+
+func (store s3Store) Close() error {
+	return nil
+}
@@ -1,152 +1,420 @@
 package main
 
 import (
-	"cloud.google.com/go/storage"
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/spf13/viper"
-	"google.golang.org/grpc/metadata"
 	"gorm.io/gorm"
-	"io"
-	"net/http"
-	"net/url"
-	"strings"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
 type Service interface {
-	ProcessImage(ctx context.Context, id uint32) error
+	ProcessImage(ctx context.Context, id uint32, specs []VariantSpec) error
+	GetStatus(ctx context.Context, id uint32) (PhotoStatus, error)
+	WatchProcessing(ctx context.Context, id uint32, send func(VariantStatus) error) error
+	ProcessBatch(ctx context.Context, ids []uint32, idAd uint32, specs []VariantSpec) ([]BatchItem, error)
+	FindSimilar(ctx context.Context, id uint32, maxDistance int, limit int) ([]SimilarPhoto, error)
+	DeletePhoto(ctx context.Context, id uint32, deleteOriginal bool) error
+	DeleteAd(ctx context.Context, idAd uint32, deleteOriginal bool) error
 }
 
 type imageService struct {
 	logger        log.Logger
 	db            *gorm.DB
-	storageClient *storage.Client
+	presets       []VariantSpec
+	formats       VariantFormats
+	watchInterval time.Duration
+	// stopping is closed when the server shuts down, which ends the watch
+	// streams that would otherwise hold up the shutdown.
+	stopping <-chan struct{}
 }
 
+// Photo is a photo of an ad. Deleted photos are kept, without their objects,
+// for the audit trail.
 type Photo struct {
 	IdPhoto     uint `gorm:"primaryKey"`
 	IdAd        uint
-	UrlOriginal string
-	UrlSmall    string
-	UrlMedium   string
-	UrlLarge    string
+	UrlOriginal string `gorm:"index"`
+	UrlSmall    string `gorm:"index"`
+	UrlMedium   string `gorm:"index"`
+	UrlLarge    string `gorm:"index"`
+	BlurHash    string
+	Placeholder string
+	// PerceptualHash is the dHash of the original, its bands index it for
+	// FindSimilar. All are null until the original was analyzed.
+	PerceptualHash *int64
+	HashBand0      *int32         `gorm:"index"`
+	HashBand1      *int32         `gorm:"index"`
+	HashBand2      *int32         `gorm:"index"`
+	HashBand3      *int32         `gorm:"index"`
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
 }
 
 func (Photo) TableName() string {
 	return "t_photo"
 }
 
-func MakeService(logger log.Logger, db *gorm.DB, storageClient *storage.Client) Service {
-	db.AutoMigrate(&Photo{})
+// PhotoStatus is the processing state of a photo. BlurHash and Placeholder,
+// a data URI of a tiny JPEG, are set once the original was analyzed.
+type PhotoStatus struct {
+	Id          uint32
+	Variants    []VariantStatus
+	BlurHash    string
+	Placeholder string
+}
+
+// BatchItem tells whether a photo of a batch was queued for processing.
+type BatchItem struct {
+	Id       uint32
+	Accepted bool
+	Reason   string
+}
+
+type VariantStatus struct {
+	Name        string
+	State       string
+	Url         string
+	Width       int
+	Height      int
+	Backend     string
+	Attempts    int
+	LastError   string
+	ContentType string
+}
+
+func MakeService(logger log.Logger, db *gorm.DB, presets []VariantSpec, formats VariantFormats, watchInterval time.Duration, stopping <-chan struct{}) Service {
+	db.AutoMigrate(&Photo{}, &ProcessingJob{}, &PhotoVariant{}, &StorageObject{}, &DeletionAudit{})
 	return &imageService{
 		logger:        log.With(logger, "component", "service"),
 		db:            db,
-		storageClient: storageClient,
+		presets:       presets,
+		formats:       formats,
+		watchInterval: watchInterval,
+		stopping:      stopping,
 	}
 }
 
-func (service imageService) ProcessImage(ctx context.Context, id uint32) error {
-	md, _ := metadata.FromIncomingContext(ctx)
-	logger := log.With(service.logger, "request-id", md["request-id"][0])
+func (service imageService) ProcessImage(ctx context.Context, id uint32, specs []VariantSpec) error {
+	logger := log.With(service.logger, "request-id", RequestIdFromContext(ctx))
 
 	level.Info(logger).Log("msg", "request received", "context", fmt.Sprintf("\"id\":%d", id))
-	var photo Photo
-	service.db.First(&photo, id)
-	go service.resizeImage(logger, photo, 1280, "url_large")
-	go service.resizeImage(logger, photo, 960, "url_medium")
-	go service.resizeImage(logger, photo, 640, "url_small")
+	if id == 0 {
+		return invalidInput(fmt.Errorf("photo id is required"))
+	}
+	variants, err := service.resolveVariants(specs)
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	err = service.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var photo Photo
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&photo, id).Error; err != nil {
+			return dbError(err, fmt.Sprintf("photo %d", id))
+		}
+		inFlight, err := inFlightPhotos(tx, []uint{photo.IdPhoto})
+		if err != nil {
+			return dbError(err, "processing jobs")
+		}
+		if inFlight[photo.IdPhoto] {
+			return fmt.Errorf("photo %d: %w", id, ErrAlreadyProcessing)
+		}
+
+		jobs := photoJobs(ctx, photo, variants, service.presets)
+		if err := tx.Create(&jobs).Error; err != nil {
+			return dbError(err, "processing jobs")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "processing jobs queued", "context", fmt.Sprintf("\"id\":%d", id))
 	return nil
 }
 
-func (service imageService) resizeImage(logger log.Logger, photo Photo, pix int, fieldName string) {
-	viper.AutomaticEnv()
-	apiUrl := "https://api.kraken.io/v1/url"
-	payload := strings.NewReader(`{
-		"auth": {
-			"api_key": "` + viper.GetString("KRAKEN_API_KEY") + `",
-			"api_secret": "` + viper.GetString("KRAKEN_API_SECRET") + `"
-		},
-		"url": "` + photo.UrlOriginal + `",
-		"resize": {
-			"width": ` + fmt.Sprint(pix) + `,
-			"height": ` + fmt.Sprint(pix) + `,
-			"strategy": "auto",
-			"enhance": true
-		},
-		"wait": true
-	}`)
-
-	resp, err := http.Post(apiUrl, "application/json", payload)
+// resolveVariants returns the variants to produce for the requested specs,
+// including the sibling formats.
+func (service imageService) resolveVariants(specs []VariantSpec) ([]VariantSpec, error) {
+	variants, err := resolveVariants(specs, service.presets)
+	if err != nil {
+		return nil, err
+	}
+	return withSiblings(variants, service.formats)
+}
+
+// photoJobs returns a queued job for every variant of the photo and one
+// analyzing its original. Variants that differ from the preset of their name
+// are marked custom. The request id and trace context of ctx are kept
+// on the jobs, so the workers' logs, spans and outbound calls are tied to the
+// request that queued them.
+func photoJobs(ctx context.Context, photo Photo, variants []VariantSpec, presets []VariantSpec) []ProcessingJob {
+	jobs := []ProcessingJob{{
+		IdPhoto:     photo.IdPhoto,
+		Kind:        JobKindAnalyze,
+		State:       JobQueued,
+		RunAt:       time.Now(),
+		RequestId:   RequestIdFromContext(ctx),
+		TraceParent: traceParent(ctx),
+	}}
+	for _, variant := range variants {
+		preset, ok := findVariant(presets, variant.Name)
+		jobs = append(jobs, ProcessingJob{
+			IdPhoto:     photo.IdPhoto,
+			Kind:        JobKindResize,
+			Variant:     variant.Name,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			Fit:         variant.Fit,
+			Format:      variant.Format,
+			Quality:     variant.Quality,
+			Custom:      !ok || preset != variant,
+			State:       JobQueued,
+			RunAt:       time.Now(),
+			RequestId:   RequestIdFromContext(ctx),
+			TraceParent: traceParent(ctx),
+		})
+	}
+	return jobs
+}
 
+// maxBatchSize bounds the photos a batch names by id, as all of them are
+// locked in one transaction.
+const maxBatchSize = 100
+
+// ProcessBatch queues the given photos and all photos of the ad idAd, if it
+// is set, in one transaction. Unknown photos and photos which still have
+// unfinished resize jobs are rejected.
+func (service imageService) ProcessBatch(ctx context.Context, ids []uint32, idAd uint32, specs []VariantSpec) ([]BatchItem, error) {
+	logger := log.With(service.logger, "request-id", RequestIdFromContext(ctx))
+	level.Info(logger).Log("msg", "batch request received", "context", fmt.Sprintf("\"ids\":%v,\"id_ad\":%d", ids, idAd))
+	if len(ids) == 0 && idAd == 0 {
+		return nil, invalidInput(fmt.Errorf("batch names neither photos nor an ad"))
+	}
+	if len(ids) > maxBatchSize {
+		return nil, invalidInput(fmt.Errorf("at most %d photos can be queued in one batch", maxBatchSize))
+	}
+	variants, err := service.resolveVariants(specs)
 	if err != nil {
-		level.Error(logger).Log("context", "kraken.io API call", "msg", err)
-		service.resizeImageFallback(logger, photo, pix, fieldName)
-		return
+		return nil, invalidInput(err)
 	}
 
-	var res map[string]interface{}
-	defer resp.Body.Close()
-	json.NewDecoder(resp.Body).Decode(&res)
+	var items []BatchItem
+	err = service.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		items = nil
+		// Locking the photos serializes concurrent batches touching them, so
+		// the in-flight check below can not race.
+		var photos []Photo
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id_photo")
+		switch {
+		case idAd != 0 && len(ids) > 0:
+			query = query.Where("id_ad = ? OR id_photo IN ?", idAd, ids)
+		case idAd != 0:
+			query = query.Where("id_ad = ?", idAd)
+		default:
+			query = query.Where("id_photo IN ?", ids)
+		}
+		if err := query.Find(&photos).Error; err != nil {
+			return dbError(err, "photos")
+		}
 
-	response, err := http.Get(fmt.Sprintf("%v", res["kraked_url"]))
+		var photoIds []uint
+		for _, photo := range photos {
+			photoIds = append(photoIds, photo.IdPhoto)
+		}
+		inFlight, err := inFlightPhotos(tx, photoIds)
+		if err != nil {
+			return dbError(err, "processing jobs")
+		}
+
+		var jobs []ProcessingJob
+		found := map[uint32]bool{}
+		for _, photo := range photos {
+			id := uint32(photo.IdPhoto)
+			found[id] = true
+			if inFlight[photo.IdPhoto] {
+				items = append(items, BatchItem{Id: id, Reason: "already processing"})
+				continue
+			}
+			jobs = append(jobs, photoJobs(ctx, photo, variants, service.presets)...)
+			items = append(items, BatchItem{Id: id, Accepted: true})
+		}
+		for _, id := range ids {
+			if !found[id] {
+				found[id] = true
+				items = append(items, BatchItem{Id: id, Reason: "not found"})
+			}
+		}
+
+		if len(jobs) == 0 {
+			return nil
+		}
+		if err := tx.Create(&jobs).Error; err != nil {
+			return dbError(err, "processing jobs")
+		}
+		return nil
+	})
 	if err != nil {
-		level.Error(logger).Log("context", "kraken.io image download", "msg", err)
-		service.resizeImageFallback(logger, photo, pix, fieldName)
-		return
+		return nil, err
 	}
-	defer response.Body.Close()
+	level.Info(logger).Log("msg", "batch processed", "context", fmt.Sprintf("\"photos\":%d", len(items)))
+	return items, nil
+}
 
-	if response.StatusCode != 200 {
-		level.Error(logger).Log("context", "kraken.io image download", "msg", fmt.Sprintf("Received non 200 response code: %d", response.StatusCode))
-		service.resizeImageFallback(logger, photo, pix, fieldName)
-		return
+func (service imageService) GetStatus(ctx context.Context, id uint32) (PhotoStatus, error) {
+	var photo Photo
+	if err := service.db.WithContext(ctx).First(&photo, id).Error; err != nil {
+		return PhotoStatus{}, dbError(err, fmt.Sprintf("photo %d", id))
+	}
+	jobs, err := latestJobs(service.db.WithContext(ctx), photo.IdPhoto)
+	if err != nil {
+		return PhotoStatus{}, dbError(err, "processing jobs")
+	}
+	variants, err := photoVariants(service.db.WithContext(ctx), photo.IdPhoto)
+	if err != nil {
+		return PhotoStatus{}, dbError(err, "photo variants")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
-	defer cancel()
-	bucketName := "meshetr-images"
-	objectName := fmt.Sprintf("%d-%d", photo.IdAd, time.Now().UnixNano())
-	url := fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucketName, objectName)
-	writer := service.storageClient.Bucket(bucketName).Object(objectName).NewWriter(ctx)
-	defer writer.Close()
-	if _, err := io.Copy(writer, response.Body); err != nil {
-		level.Error(logger).Log("context", "Storage upload", "msg", err)
-		service.resizeImageFallback(logger, photo, pix, fieldName)
-		return
+	status := PhotoStatus{Id: id, BlurHash: photo.BlurHash, Placeholder: photo.Placeholder}
+	seen := map[string]bool{}
+	for _, job := range jobs {
+		seen[job.Variant] = true
+		variant := variants[job.Variant]
+		status.Variants = append(status.Variants, VariantStatus{
+			Name:        job.Variant,
+			State:       job.State,
+			Url:         variant.Url,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			Backend:     variant.Backend,
+			Attempts:    job.Attempts,
+			LastError:   job.LastError,
+			ContentType: variant.ContentType,
+		})
 	}
 
-	service.db.Model(&photo).Update(fieldName, url)
-	logContext, _ := json.Marshal(photo)
-	level.Info(logger).Log("context", logContext, "msg", "Resized photo successfully uploaded.")
+	// Photos resized before jobs were recorded only have the legacy columns.
+	legacy := map[string]string{"large": photo.UrlLarge, "medium": photo.UrlMedium, "small": photo.UrlSmall}
+	for _, name := range []string{"large", "medium", "small"} {
+		if url := legacy[name]; !seen[name] && url != "" {
+			status.Variants = append(status.Variants, VariantStatus{Name: name, State: JobSucceeded, Url: url})
+		}
+	}
+	return status, nil
 }
 
-func (service imageService) resizeImageFallback(logger log.Logger, photo Photo, pix int, fieldName string) {
-	logContext, _ := json.Marshal(photo)
-	level.Warn(logger).Log("context", logContext, "msg", "Image resizing FALLBACK.")
+// WatchProcessing sends every change of a variant's state until all variants
+// of the photo reached a terminal state. The state is polled from Postgres,
+// so changes made by workers on any replica are seen. Photos that were never
+// queued have nothing to wait for and fail with ErrNotReady right away. Once
+// the server shuts down watching fails with ErrUnavailable, so clients watch
+// on through another replica.
+func (service imageService) WatchProcessing(ctx context.Context, id uint32, send func(VariantStatus) error) error {
+	sent := map[string]VariantStatus{}
+	for {
+		status, err := service.GetStatus(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if len(status.Variants) == 0 {
+			return fmt.Errorf("photo %d has no processing jobs: %w", id, ErrNotReady)
+		}
 
-	viper.AutomaticEnv()
-	response, err := http.Get(fmt.Sprintf("https://api.imageresizer.io/v1/images?key=%s&url=%s",
-		viper.GetString("IMAGERESIZER_API_KEY"),
-		url.QueryEscape(photo.UrlOriginal)))
+		done := true
+		for _, variant := range status.Variants {
+			if last, ok := sent[variant.Name]; !ok || last.State != variant.State || last.Attempts != variant.Attempts {
+				if err := send(variant); err != nil {
+					return err
+				}
+				sent[variant.Name] = variant
+			}
+			if variant.State != JobSucceeded && variant.State != JobDead && variant.State != JobInvalid {
+				done = false
+			}
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-service.stopping:
+			return fmt.Errorf("server shutting down: %w", ErrUnavailable)
+		case <-time.After(service.watchInterval):
+		}
+	}
+}
+
+// FindSimilar returns the photos of other ads whose original is within
+// maxDistance bits of the photo's perceptual hash, closest first. A zero
+// limit returns the default number of photos.
+func (service imageService) FindSimilar(ctx context.Context, id uint32, maxDistance int, limit int) ([]SimilarPhoto, error) {
+	if maxDistance < 0 || maxDistance > maxSimilarDistance {
+		return nil, invalidInput(fmt.Errorf("max distance must be between 0 and %d", maxSimilarDistance))
+	}
+	if limit == 0 {
+		limit = defaultSimilarLimit
+	}
+	if limit < 0 || limit > maxSimilarLimit {
+		return nil, invalidInput(fmt.Errorf("limit must be between 0 and %d", maxSimilarLimit))
+	}
+
+	var photo Photo
+	if err := service.db.WithContext(ctx).First(&photo, id).Error; err != nil {
+		return nil, dbError(err, fmt.Sprintf("photo %d", id))
+	}
+	if photo.PerceptualHash == nil {
+		return nil, fmt.Errorf("photo %d has not been analyzed: %w", id, ErrNotReady)
+	}
+	similar, err := findSimilarPhotos(service.db.WithContext(ctx), uint64(*photo.PerceptualHash), photo.IdAd, maxDistance, limit)
 	if err != nil {
-		level.Error(logger).Log("context", "imageresizer API call", "msg", err)
-		return
-	}
-	defer response.Body.Close()
-	if response.StatusCode != 200 {
-		level.Error(logger).Log("context", "imageresizer API call", "msg", fmt.Sprintf("Received non 200 response code: %d", response.StatusCode))
-		return
-	}
-	var res map[string]interface{}
-	json.NewDecoder(response.Body).Decode(&res)
-	imageresizerResponse := res["response"].(map[string]interface{})
-	id := imageresizerResponse["id"].(string)
-	url := "https://im.ages.io/" + id + "?width=" + fmt.Sprint(pix)
-
-	service.db.Model(&photo).Update(fieldName, url)
-	level.Info(logger).Log("context", logContext, "msg", "Resized photo successfully uploaded (FALLBACK).")
+		return nil, dbError(err, "similar photos")
+	}
+	return similar, nil
+}
+
+// DeletePhoto deletes a photo. It is gone for the service right away, its
+// objects are removed from storage by a delete job, which is retried until
+// it succeeds.
+func (service imageService) DeletePhoto(ctx context.Context, id uint32, deleteOriginal bool) error {
+	logger := log.With(service.logger, "request-id", RequestIdFromContext(ctx))
+	level.Info(logger).Log("msg", "delete request received", "context", fmt.Sprintf("\"id\":%d,\"delete_original\":%t", id, deleteOriginal))
+	if id == 0 {
+		return invalidInput(fmt.Errorf("photo id is required"))
+	}
+	return service.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var photo Photo
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&photo, id).Error; err != nil {
+			return dbError(err, fmt.Sprintf("photo %d", id))
+		}
+		if err := deletePhotos(ctx, tx, []Photo{photo}, deleteOriginal); err != nil {
+			return dbError(err, fmt.Sprintf("deleting photo %d", id))
+		}
+		return nil
+	})
+}
+
+// DeleteAd deletes all photos of an ad like DeletePhoto. Ads without photos
+// are not an error, so deleting an ad again succeeds.
+func (service imageService) DeleteAd(ctx context.Context, idAd uint32, deleteOriginal bool) error {
+	logger := log.With(service.logger, "request-id", RequestIdFromContext(ctx))
+	level.Info(logger).Log("msg", "delete ad request received", "context", fmt.Sprintf("\"id_ad\":%d,\"delete_original\":%t", idAd, deleteOriginal))
+	if idAd == 0 {
+		return invalidInput(fmt.Errorf("ad id is required"))
+	}
+	return service.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var photos []Photo
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id_ad = ?", idAd).Order("id_photo").Find(&photos).Error
+		if err != nil {
+			return dbError(err, "photos")
+		}
+		if err := deletePhotos(ctx, tx, photos, deleteOriginal); err != nil {
+			return dbError(err, fmt.Sprintf("deleting photos of ad %d", idAd))
+		}
+		level.Info(logger).Log("msg", "photos deleted", "context", fmt.Sprintf("\"id_ad\":%d,\"photos\":%d", idAd, len(photos)))
+		return nil
+	})
 }
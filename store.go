@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	Updated     time.Time
+}
+
+// PutOptions are the metadata of an uploaded object. Size is the number of
+// bytes the reader yields, zero if it is unknown. S3 needs it to upload the
+// object in a single request instead of buffering large multipart chunks.
+type PutOptions struct {
+	ContentType  string
+	CacheControl string
+	Size         int64
+}
+
+// ObjectStore is the bucket the resized variants are uploaded to.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, reader io.Reader, opts PutOptions) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List calls fn for every object whose key starts with prefix, stopping
+	// at the first error fn returns.
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	URL(key string) string
+	Close() error
+}
+
+const defaultBucket = "meshetr-images"
+
+// MakeObjectStore creates the object store selected by STORAGE_BACKEND:
+// "gcs" (default), "local" or "s3".
+func MakeObjectStore(ctx context.Context) (ObjectStore, error) {
+	viper.AutomaticEnv()
+	viper.SetDefault("STORAGE_BUCKET", defaultBucket)
+	bucket := viper.GetString("STORAGE_BUCKET")
+	publicUrl := viper.GetString("STORAGE_PUBLIC_URL")
+
+	switch backend := viper.GetString("STORAGE_BACKEND"); backend {
+	case "", "gcs":
+		return NewGCSStore(ctx, []byte(viper.GetString("GCP_CLIENT_SECRET")), bucket, publicUrl)
+	case "local":
+		viper.SetDefault("STORAGE_LOCAL_DIR", "images")
+		viper.SetDefault("STORAGE_PUBLIC_URL", "http://localhost:8080")
+		return NewLocalStore(viper.GetString("STORAGE_LOCAL_DIR"), viper.GetString("STORAGE_PUBLIC_URL"))
+	case "s3":
+		return NewS3Store(
+			viper.GetString("S3_ENDPOINT"),
+			viper.GetString("S3_ACCESS_KEY"),
+			viper.GetString("S3_SECRET_KEY"),
+			viper.GetBool("S3_USE_SSL"),
+			bucket,
+			publicUrl,
+		)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// ObjectUrls maps URLs stored in the database back to object keys. Besides
+// the store's public URL, which may be a CDN, the URLs older rows were saved
+// with are understood: the path-style and virtual-hosted GCS forms of the
+// bucket, with percent-encoded keys.
+type ObjectUrls struct {
+	public *url.URL
+	bucket string
+}
+
+func MakeObjectUrls(store ObjectStore) ObjectUrls {
+	viper.SetDefault("STORAGE_BUCKET", defaultBucket)
+	public, _ := url.Parse(store.URL(""))
+	return ObjectUrls{public: public, bucket: strings.ToLower(viper.GetString("STORAGE_BUCKET"))}
+}
+
+// Urls returns the URLs under which rows may refer to the object stored
+// under key, in the forms Key understands, so they can be looked up by an
+// index.
+func (urls ObjectUrls) Urls(key string) []string {
+	var bases []string
+	if urls.public != nil {
+		bases = append(bases, strings.TrimSuffix(urls.public.String(), "/"))
+	}
+	bases = append(bases,
+		"https://storage.googleapis.com/"+urls.bucket,
+		"https://storage.cloud.google.com/"+urls.bucket,
+		"https://"+urls.bucket+".storage.googleapis.com",
+	)
+	paths := []string{key}
+	if escaped := (&url.URL{Path: key}).EscapedPath(); escaped != key {
+		paths = append(paths, escaped)
+	}
+	var result []string
+	seen := map[string]bool{}
+	for _, base := range bases {
+		for _, path := range paths {
+			if u := base + "/" + path; !seen[u] {
+				seen[u] = true
+				result = append(result, u)
+			}
+		}
+	}
+	return result
+}
+
+// Key returns the key of the object rawUrl refers to, if it is an object of
+// the store.
+func (urls ObjectUrls) Key(rawUrl string) (string, bool) {
+	if rawUrl == "" {
+		return "", false
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", false
+	}
+	host := strings.ToLower(u.Host)
+	var key string
+	switch {
+	case urls.public != nil && host == strings.ToLower(urls.public.Host) && strings.HasPrefix(u.Path, urls.public.Path):
+		key = strings.TrimPrefix(u.Path, urls.public.Path)
+	case (host == "storage.googleapis.com" || host == "storage.cloud.google.com") && strings.HasPrefix(u.Path, "/"+urls.bucket+"/"):
+		key = strings.TrimPrefix(u.Path, "/"+urls.bucket+"/")
+	case host == urls.bucket+".storage.googleapis.com":
+		key = strings.TrimPrefix(u.Path, "/")
+	default:
+		return "", false
+	}
+	return key, key != ""
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagation"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+const tracerName = "image-processor"
+
+// tracedClient is the HTTP client for outbound calls. It records a span for
+// every request and passes the trace context on in its headers.
+var tracedClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// MakeTracerProvider installs the global tracer provider and W3C trace
+// context propagator. OTEL_EXPORTER selects where spans go: "otlp" sends them
+// to the collector at OTEL_EXPORTER_OTLP_ENDPOINT, "stdout" prints them for
+// local debugging and "none", the default, drops them. The returned function
+// flushes pending spans and must be called before exiting.
+func MakeTracerProvider(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	viper.SetDefault("OTEL_EXPORTER", "none")
+	viper.SetDefault("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4317")
+	var exporter export.SpanExporter
+	switch backend := viper.GetString("OTEL_EXPORTER"); backend {
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		driver := otlpgrpc.NewDriver(
+			otlpgrpc.WithEndpoint(viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT")),
+			otlpgrpc.WithInsecure(),
+		)
+		otlpExporter, err := otlp.NewExporter(ctx, driver)
+		if err != nil {
+			return nil, err
+		}
+		exporter = otlpExporter
+	case "stdout":
+		stdoutExporter, err := stdout.NewExporter(stdout.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		exporter = stdoutExporter
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", backend)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(tracerName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startSpan starts a span of this service as a child of the span in ctx.
+func startSpan(ctx context.Context, name string, labels ...label.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(labels...))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceCarrier keeps propagated trace context as a header-like string, so it
+// can be stored on a job row and picked up by whichever worker claims it.
+type traceCarrier map[string]string
+
+func (carrier traceCarrier) Get(key string) string {
+	return carrier[key]
+}
+
+func (carrier traceCarrier) Set(key string, value string) {
+	carrier[key] = value
+}
+
+// traceParent returns the W3C traceparent of the span in ctx, or an empty
+// string when ctx is not traced.
+func traceParent(ctx context.Context) string {
+	carrier := traceCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier["traceparent"]
+}
+
+// withTraceParent returns a context carrying the remote span of a
+// traceparent stored by traceParent.
+func withTraceParent(ctx context.Context, parent string) context.Context {
+	if parent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, traceCarrier{"traceparent": parent})
+}
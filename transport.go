@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	gt "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"image-processor/pb"
 )
 
 type gRPCServer struct {
-	process gt.Handler
-	logger  log.Logger
+	process   gt.Handler
+	getStatus gt.Handler
+	watch     endpoint.Endpoint
+	batch     gt.Handler
+	similar   gt.Handler
+	delete    gt.Handler
+	deleteAd  gt.Handler
+	logger    log.Logger
 	pb.UnimplementedImageProcessorServiceServer
 }
 
@@ -20,6 +31,32 @@ func NewGRPCServer(logger log.Logger, endpoints Endpoints) pb.ImageProcessorServ
 			decodeProcessRequest,
 			encodeProcessResponse,
 		),
+		getStatus: gt.NewServer(
+			endpoints.GetStatusEndpoint,
+			decodeGetStatusRequest,
+			encodeGetStatusResponse,
+		),
+		watch: endpoints.WatchEndpoint,
+		batch: gt.NewServer(
+			endpoints.BatchEndpoint,
+			decodeBatchRequest,
+			encodeBatchResponse,
+		),
+		similar: gt.NewServer(
+			endpoints.SimilarEndpoint,
+			decodeSimilarRequest,
+			encodeSimilarResponse,
+		),
+		delete: gt.NewServer(
+			endpoints.DeleteEndpoint,
+			decodeDeleteRequest,
+			encodeDeleteResponse,
+		),
+		deleteAd: gt.NewServer(
+			endpoints.DeleteAdEndpoint,
+			decodeDeleteAdRequest,
+			encodeDeleteResponse,
+		),
 	}
 }
 
@@ -31,15 +68,253 @@ func (server *gRPCServer) Process(ctx context.Context, req *pb.Image) (*pb.Statu
 	return resp.(*pb.Status), nil
 }
 
+func (server *gRPCServer) GetStatus(ctx context.Context, req *pb.Image) (*pb.PhotoStatus, error) {
+	_, resp, err := server.getStatus.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PhotoStatus), nil
+}
+
+func (server *gRPCServer) ProcessBatch(ctx context.Context, req *pb.Batch) (*pb.BatchResult, error) {
+	_, resp, err := server.batch.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.BatchResult), nil
+}
+
+func (server *gRPCServer) FindSimilar(ctx context.Context, req *pb.SimilarRequest) (*pb.SimilarPhotos, error) {
+	_, resp, err := server.similar.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.SimilarPhotos), nil
+}
+
+func (server *gRPCServer) DeletePhoto(ctx context.Context, req *pb.Image) (*pb.Status, error) {
+	_, resp, err := server.delete.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.Status), nil
+}
+
+func (server *gRPCServer) DeleteAd(ctx context.Context, req *pb.AdRef) (*pb.Status, error) {
+	_, resp, err := server.deleteAd.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.Status), nil
+}
+
+// WatchProcessing calls the endpoint directly, go-kit's gRPC transport does
+// not support server streaming.
+func (server *gRPCServer) WatchProcessing(req *pb.Image, stream pb.ImageProcessorService_WatchProcessingServer) error {
+	resp, err := server.watch(stream.Context(), WatchRequest{
+		Id: req.Id,
+		Send: func(variant VariantStatus) error {
+			return stream.Send(&pb.ProcessingEvent{Id: req.Id, Variant: encodeVariantStatus(variant)})
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := resp.(WatchResponse).Err; err != nil {
+		return encodeError(err)
+	}
+	return nil
+}
+
 func decodeProcessRequest(ctx context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.Image)
-	return ProcessRequest{Id: req.Id}, nil
+	return ProcessRequest{Id: req.Id, Variants: decodeVariantSpecs(req.Variants)}, nil
+}
+
+var fitModes = map[pb.FitMode]string{
+	pb.FitMode_FitContain: FitContain,
+	pb.FitMode_FitCover:   FitCover,
+	pb.FitMode_FitExact:   FitExact,
+}
+
+var imageFormats = map[pb.ImageFormat]string{
+	pb.ImageFormat_FormatOriginal: FormatOriginal,
+	pb.ImageFormat_FormatJpeg:     FormatJpeg,
+	pb.ImageFormat_FormatPng:      FormatPng,
+	pb.ImageFormat_FormatWebp:     FormatWebp,
+	pb.ImageFormat_FormatAvif:     FormatAvif,
+}
+
+func decodeVariantSpecs(variants []*pb.VariantSpec) []VariantSpec {
+	var specs []VariantSpec
+	for _, variant := range variants {
+		fit, ok := fitModes[variant.Fit]
+		if !ok {
+			fit = variant.Fit.String()
+		}
+		format, ok := imageFormats[variant.Format]
+		if !ok {
+			format = variant.Format.String()
+		}
+		specs = append(specs, VariantSpec{
+			Name: variant.Name,
+			ResizeSpec: ResizeSpec{
+				Width:   int(variant.MaxWidth),
+				Height:  int(variant.MaxHeight),
+				Fit:     fit,
+				Format:  format,
+				Quality: int(variant.Quality),
+			},
+		})
+	}
+	return specs
 }
 
 func encodeProcessResponse(ctx context.Context, response interface{}) (interface{}, error) {
 	resp := response.(ProcessResponse)
 	if resp.Err != nil {
-		return &pb.Status{Code: pb.StatusCode_Failed, Message: resp.Err.Error()}, nil
+		return nil, encodeError(resp.Err)
 	}
 	return &pb.Status{Code: pb.StatusCode_Ok, Message: "OK"}, nil
 }
+
+func decodeGetStatusRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.Image)
+	return GetStatusRequest{Id: req.Id}, nil
+}
+
+var processingStates = map[string]pb.ProcessingState{
+	JobQueued:    pb.ProcessingState_ProcessingQueued,
+	JobRunning:   pb.ProcessingState_ProcessingRunning,
+	JobSucceeded: pb.ProcessingState_ProcessingSucceeded,
+	JobFailed:    pb.ProcessingState_ProcessingFailed,
+	JobDead:      pb.ProcessingState_ProcessingDead,
+	JobInvalid:   pb.ProcessingState_ProcessingInvalid,
+}
+
+func encodeGetStatusResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	resp := response.(GetStatusResponse)
+	if resp.Err != nil {
+		return nil, encodeError(resp.Err)
+	}
+	status := &pb.PhotoStatus{
+		Id:          resp.Status.Id,
+		BlurHash:    resp.Status.BlurHash,
+		Placeholder: resp.Status.Placeholder,
+	}
+	for _, variant := range resp.Status.Variants {
+		status.Variants = append(status.Variants, encodeVariantStatus(variant))
+	}
+	return status, nil
+}
+
+func encodeVariantStatus(variant VariantStatus) *pb.VariantStatus {
+	return &pb.VariantStatus{
+		Name:        variant.Name,
+		State:       processingStates[variant.State],
+		Url:         variant.Url,
+		Width:       uint32(variant.Width),
+		Height:      uint32(variant.Height),
+		Backend:     variant.Backend,
+		Attempts:    uint32(variant.Attempts),
+		LastError:   variant.LastError,
+		ContentType: variant.ContentType,
+	}
+}
+
+func decodeBatchRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.Batch)
+	return BatchRequest{Ids: req.Ids, IdAd: req.IdAd, Variants: decodeVariantSpecs(req.Variants)}, nil
+}
+
+func encodeBatchResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	resp := response.(BatchResponse)
+	if resp.Err != nil {
+		return nil, encodeError(resp.Err)
+	}
+	result := &pb.BatchResult{}
+	for _, item := range resp.Items {
+		result.Results = append(result.Results, &pb.PhotoResult{
+			Id:       item.Id,
+			Accepted: item.Accepted,
+			Reason:   item.Reason,
+		})
+	}
+	return result, nil
+}
+
+func decodeSimilarRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.SimilarRequest)
+	return SimilarRequest{Id: req.Id, MaxDistance: int(req.MaxDistance), Limit: int(req.Limit)}, nil
+}
+
+func encodeSimilarResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	resp := response.(SimilarResponse)
+	if resp.Err != nil {
+		return nil, encodeError(resp.Err)
+	}
+	result := &pb.SimilarPhotos{}
+	for _, photo := range resp.Photos {
+		result.Photos = append(result.Photos, &pb.SimilarPhoto{
+			Id:       photo.Id,
+			IdAd:     photo.IdAd,
+			Distance: uint32(photo.Distance),
+		})
+	}
+	return result, nil
+}
+
+func decodeDeleteRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.Image)
+	return DeleteRequest{Id: req.Id, DeleteOriginal: req.DeleteOriginal}, nil
+}
+
+func decodeDeleteAdRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.AdRef)
+	return DeleteAdRequest{IdAd: req.IdAd, DeleteOriginal: req.DeleteOriginal}, nil
+}
+
+func encodeDeleteResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	resp := response.(DeleteResponse)
+	if resp.Err != nil {
+		return nil, encodeError(resp.Err)
+	}
+	return &pb.Status{Code: pb.StatusCode_Ok, Message: "OK"}, nil
+}
+
+// encodeError turns a domain error into a gRPC status error. Its details
+// carry a pb.Status with the matching StatusCode and an ErrorInfo, so clients
+// can branch on either. Errors that already are gRPC statuses pass through.
+func encodeError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code, statusCode, reason := codes.Internal, pb.StatusCode_Failed, "INTERNAL"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code, statusCode, reason = codes.NotFound, pb.StatusCode_NotFound, "NOT_FOUND"
+	case errors.Is(err, ErrInvalidInput):
+		code, statusCode, reason = codes.InvalidArgument, pb.StatusCode_InvalidArgument, "INVALID_INPUT"
+	case errors.Is(err, ErrUnavailable):
+		code, statusCode, reason = codes.Unavailable, pb.StatusCode_Unavailable, "UNAVAILABLE"
+	case errors.Is(err, ErrAlreadyProcessing):
+		code, statusCode, reason = codes.AlreadyExists, pb.StatusCode_AlreadyProcessing, "ALREADY_PROCESSING"
+	case errors.Is(err, ErrNotReady):
+		code, statusCode, reason = codes.FailedPrecondition, pb.StatusCode_NotReady, "NOT_READY"
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+
+	st := status.New(code, err.Error())
+	detailed, detailsErr := st.WithDetails(
+		&pb.Status{Code: statusCode, Message: err.Error()},
+		&errdetails.ErrorInfo{Reason: reason, Domain: "image-processor"},
+	)
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+)
+
+// ErrInvalidImage is returned for originals the pipeline refuses to resize.
+// Jobs failing with it are marked invalid instead of being retried.
+var ErrInvalidImage = fmt.Errorf("invalid image: %w", ErrInvalidInput)
+
+// sourceFormats are the content types of the originals we can decode, by
+// the format name image.DecodeConfig reports for them.
+var sourceFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// validateImage checks an original before any backend works on it. The
+// content type is sniffed from the data instead of trusting the URL or the
+// server, and the header is decoded first, so decompression bombs are
+// rejected by their announced size without allocating their pixels. Images
+// within the size are decoded in full, which catches truncated and corrupt
+// data: end markers can not be relied on, as embedded EXIF thumbnails and
+// LZW data contain them as well. The decoded image is returned, so it is not
+// decoded again.
+func validateImage(data []byte, maxPixels int64) (image.Image, error) {
+	contentType := http.DetectContentType(data)
+	format, ok := sourceFormats[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content type %s: %w", contentType, ErrInvalidImage)
+	}
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s header: %v: %w", format, err, ErrInvalidImage)
+	}
+	if decoded != format {
+		return nil, fmt.Errorf("%s data decodes as %s: %w", contentType, decoded, ErrInvalidImage)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("empty %dx%d image: %w", config.Width, config.Height, ErrInvalidImage)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > maxPixels {
+		return nil, fmt.Errorf("%dx%d image has more than %d pixels: %w", config.Width, config.Height, maxPixels, ErrInvalidImage)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s data: %v: %w", format, err, ErrInvalidImage)
+	}
+	return img, nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FitContain = "contain"
+	FitCover   = "cover"
+	FitExact   = "exact"
+)
+
+// FormatOriginal keeps the format of the original image. Which of the
+// other formats can be produced depends on the configured backends.
+const (
+	FormatOriginal = ""
+	FormatJpeg     = "jpeg"
+	FormatPng      = "png"
+	FormatWebp     = "webp"
+	FormatAvif     = "avif"
+)
+
+const (
+	maxVariantSide  = 8192
+	defaultPresets  = "large=1280x1280,medium=960x960,small=640x640"
+	maxVariantCount = 16
+	defaultSiblings = "webp,avif"
+)
+
+// VariantSpec is a named variant of a photo.
+type VariantSpec struct {
+	Name string
+	ResizeSpec
+}
+
+// PhotoVariant is a produced variant of a photo, stored in the object store
+// under StorageKey.
+type PhotoVariant struct {
+	Id          uint   `gorm:"primaryKey"`
+	IdPhoto     uint   `gorm:"uniqueIndex:idx_photo_variant"`
+	Name        string `gorm:"uniqueIndex:idx_photo_variant"`
+	Url         string
+	StorageKey  string `gorm:"index"`
+	Width       int
+	Height      int
+	Size        int64
+	Format      string
+	ContentType string
+	ContentHash string
+	Backend     string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (PhotoVariant) TableName() string {
+	return "t_photo_variant"
+}
+
+// legacyColumns maps the preset variants to the t_photo columns that are
+// kept up to date for older clients.
+var legacyColumns = map[string]string{
+	"large":  "url_large",
+	"medium": "url_medium",
+	"small":  "url_small",
+}
+
+var variantName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ParsePresets parses the server-side presets from a comma separated list of
+// name=WIDTHxHEIGHT entries, e.g. "large=1280x1280,small=640x640".
+func ParsePresets(value string) ([]VariantSpec, error) {
+	if strings.TrimSpace(value) == "" {
+		value = defaultPresets
+	}
+	var presets []VariantSpec
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid preset %q", entry)
+		}
+		size := strings.SplitN(parts[1], "x", 2)
+		if len(size) != 2 {
+			return nil, fmt.Errorf("invalid preset size %q", parts[1])
+		}
+		width, err := strconv.Atoi(size[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset width %q", size[0])
+		}
+		height, err := strconv.Atoi(size[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset height %q", size[1])
+		}
+		presets = append(presets, VariantSpec{
+			Name:       parts[0],
+			ResizeSpec: ResizeSpec{Width: width, Height: height, Fit: FitContain},
+		})
+	}
+	return resolveVariants(presets, nil)
+}
+
+// resolveVariants validates the requested variants and replaces specs that
+// only carry a name by the preset of that name. No specs at all select all
+// presets.
+func resolveVariants(specs []VariantSpec, presets []VariantSpec) ([]VariantSpec, error) {
+	if len(specs) == 0 {
+		return presets, nil
+	}
+	if len(specs) > maxVariantCount {
+		return nil, fmt.Errorf("at most %d variants can be requested", maxVariantCount)
+	}
+
+	var resolved []VariantSpec
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		if !variantName.MatchString(spec.Name) {
+			return nil, fmt.Errorf("invalid variant name %q", spec.Name)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("duplicate variant %q", spec.Name)
+		}
+		seen[spec.Name] = true
+
+		if spec.Width == 0 && spec.Height == 0 {
+			preset, ok := findVariant(presets, spec.Name)
+			if !ok {
+				return nil, fmt.Errorf("variant %q has no size and is no preset", spec.Name)
+			}
+			spec = preset
+		}
+		if spec.Fit == "" {
+			spec.Fit = FitContain
+		}
+		if err := validateSpec(spec); err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, spec)
+	}
+	return resolved, nil
+}
+
+func validateSpec(spec VariantSpec) error {
+	if spec.Width < 0 || spec.Height < 0 || spec.Width > maxVariantSide || spec.Height > maxVariantSide {
+		return fmt.Errorf("variant %q: size must be between 1 and %d", spec.Name, maxVariantSide)
+	}
+	switch spec.Fit {
+	case FitContain:
+		if spec.Width == 0 && spec.Height == 0 {
+			return fmt.Errorf("variant %q: width or height is required", spec.Name)
+		}
+	case FitCover, FitExact:
+		if spec.Width == 0 || spec.Height == 0 {
+			return fmt.Errorf("variant %q: fit %s needs width and height", spec.Name, spec.Fit)
+		}
+	default:
+		return fmt.Errorf("variant %q: unknown fit %q", spec.Name, spec.Fit)
+	}
+	switch spec.Format {
+	case FormatOriginal, FormatJpeg, FormatPng, FormatWebp, FormatAvif:
+	default:
+		return fmt.Errorf("variant %q: unknown format %q", spec.Name, spec.Format)
+	}
+	if spec.Quality < 0 || spec.Quality > 100 {
+		return fmt.Errorf("variant %q: quality must be between 1 and 100", spec.Name)
+	}
+	return nil
+}
+
+// VariantFormats are the output formats the resizer chain can encode, and
+// the modern formats generated as siblings of every JPEG variant.
+type VariantFormats struct {
+	Encodable map[string]bool
+	Siblings  []string
+}
+
+// MakeVariantFormats collects the formats the resizers can encode and keeps
+// the sibling formats from the comma separated list siblings that are among
+// them, e.g. AVIF is only generated when a backend can encode it.
+func MakeVariantFormats(resizers []Resizer, siblings string) (VariantFormats, error) {
+	formats := VariantFormats{Encodable: map[string]bool{FormatOriginal: true}}
+	for _, resizer := range resizers {
+		for _, format := range resizer.Formats() {
+			formats.Encodable[format] = true
+		}
+	}
+	if strings.TrimSpace(siblings) == "" {
+		siblings = defaultSiblings
+	}
+	for _, format := range splitList(siblings) {
+		if format == "none" {
+			continue
+		}
+		if err := validateSpec(VariantSpec{Name: format, ResizeSpec: ResizeSpec{Width: 1, Fit: FitContain, Format: format}}); err != nil {
+			return VariantFormats{}, err
+		}
+		if formats.Encodable[format] {
+			formats.Siblings = append(formats.Siblings, format)
+		}
+	}
+	return formats, nil
+}
+
+// withSiblings checks that the requested formats can be encoded and adds a
+// variant in each sibling format next to every JPEG variant, named after
+// both, e.g. "large-webp". Variants in the original format count as JPEG,
+// as photos almost always are.
+func withSiblings(variants []VariantSpec, formats VariantFormats) ([]VariantSpec, error) {
+	names := map[string]bool{}
+	for _, variant := range variants {
+		if !formats.Encodable[variant.Format] {
+			return nil, fmt.Errorf("variant %q: no configured backend can encode %s", variant.Name, variant.Format)
+		}
+		names[variant.Name] = true
+	}
+
+	// variants may be the shared presets, so they are copied before
+	// appending.
+	result := append([]VariantSpec(nil), variants...)
+	for _, variant := range variants {
+		if variant.Format != FormatJpeg && variant.Format != FormatOriginal {
+			continue
+		}
+		for _, format := range formats.Siblings {
+			sibling := variant
+			sibling.Name = variant.Name + "-" + format
+			sibling.Format = format
+			if names[sibling.Name] {
+				continue
+			}
+			names[sibling.Name] = true
+			result = append(result, sibling)
+		}
+	}
+	return result, nil
+}
+
+func findVariant(specs []VariantSpec, name string) (VariantSpec, bool) {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return VariantSpec{}, false
+}
+
+// saveVariant stores a produced variant, replacing an earlier one of the same
+// name, and keeps the legacy url_* column of the photo in sync unless the
+// variant is custom, as older clients expect the presets there. The caller
+// holds a reference to the object of the new variant, taken before it was
+// uploaded, which passes to the variant; the replaced variant's object loses
+// its reference.
+func saveVariant(db *gorm.DB, photo Photo, variant PhotoVariant, custom bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var previous []PhotoVariant
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id_photo = ? AND name = ?", variant.IdPhoto, variant.Name).
+			Find(&previous).Error
+		if err != nil {
+			return err
+		}
+		if len(previous) > 0 && previous[0].StorageKey != "" {
+			if err := releaseObject(tx, previous[0].StorageKey); err != nil {
+				return err
+			}
+		}
+
+		err = tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "id_photo"}, {Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"url", "storage_key", "width", "height", "size", "format", "content_type", "content_hash", "backend", "updated_at",
+			}),
+		}).Create(&variant).Error
+		if err != nil {
+			return err
+		}
+		if column, ok := legacyColumns[variant.Name]; ok && !custom {
+			return tx.Model(&photo).Update(column, variant.Url).Error
+		}
+		return nil
+	})
+}
+
+// photoVariants returns the stored variants of a photo by name.
+func photoVariants(db *gorm.DB, photoId uint) (map[string]PhotoVariant, error) {
+	var variants []PhotoVariant
+	if err := db.Where("id_photo = ?", photoId).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	byName := map[string]PhotoVariant{}
+	for _, variant := range variants {
+		byName[variant.Name] = variant
+	}
+	return byName, nil
+}
+
+// formatOf returns the image format of a variant from its content type,
+// falling back to the requested format.
+func formatOf(contentType string, requested string) string {
+	if strings.HasPrefix(contentType, "image/") {
+		return strings.TrimPrefix(strings.SplitN(contentType, ";", 2)[0], "image/")
+	}
+	return requested
+}
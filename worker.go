@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/otel/label"
+	"gorm.io/gorm"
+	"image"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ImagePolicy holds the limits for originals, what is kept of their
+// metadata and how variants are stored.
+type ImagePolicy struct {
+	// MaxPixels is the largest original accepted, in pixels.
+	MaxPixels int64
+	// KeepICC keeps the ICC colour profile in the variants.
+	KeepICC bool
+	// CacheControl is set on the uploaded variants.
+	CacheControl string
+}
+
+// WorkerPool claims processing jobs from Postgres and runs them through the
+// resizer chain.
+type WorkerPool struct {
+	// heartbeat is the UnixNano time a worker last went round its loop,
+	// accessed atomically.
+	heartbeat    int64
+	logger       log.Logger
+	db           *gorm.DB
+	store        ObjectStore
+	urls         ObjectUrls
+	fetcher      *Fetcher
+	images       ImagePolicy
+	resizers     []Resizer
+	size         int
+	lease        time.Duration
+	pollInterval time.Duration
+	retry        RetryPolicy
+	metrics      *Metrics
+	// jobs is the context of the jobs being processed. It is separate from
+	// the context Run stops claiming on, so that Drain can let them finish.
+	jobs  context.Context
+	abort context.CancelFunc
+	done  chan struct{}
+}
+
+func MakeWorkerPool(logger log.Logger, db *gorm.DB, store ObjectStore, fetcher *Fetcher, images ImagePolicy, resizers []Resizer, size int, lease time.Duration, pollInterval time.Duration, retry RetryPolicy, m *Metrics) *WorkerPool {
+	jobs, abort := context.WithCancel(context.Background())
+	return &WorkerPool{
+		logger:       log.With(logger, "component", "worker"),
+		db:           db,
+		store:        store,
+		urls:         MakeObjectUrls(store),
+		fetcher:      fetcher,
+		images:       images,
+		resizers:     resizers,
+		size:         size,
+		lease:        lease,
+		pollInterval: pollInterval,
+		retry:        retry,
+		metrics:      m,
+		jobs:         jobs,
+		abort:        abort,
+		done:         make(chan struct{}),
+	}
+}
+
+// Run starts the workers and blocks until ctx is cancelled and all of them
+// returned. Cancelling ctx only stops claiming new jobs; use Drain to wait
+// for the jobs in progress.
+func (pool *WorkerPool) Run(ctx context.Context) {
+	defer close(pool.done)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pool.reportQueueDepth(ctx)
+	}()
+	for i := 0; i < pool.size; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// reportQueueDepth periodically publishes the number of jobs per state.
+func (pool *WorkerPool) reportQueueDepth(ctx context.Context) {
+	for {
+		depth, err := countJobs(pool.db.WithContext(ctx))
+		if err == nil {
+			for _, state := range []string{JobQueued, JobRunning, JobFailed, JobDead, JobInvalid} {
+				pool.metrics.QueueDepth.With("state", state).Set(float64(depth[state]))
+			}
+		} else if ctx.Err() == nil {
+			level.Error(pool.logger).Log("context", "count jobs", "msg", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(15 * time.Second):
+		}
+	}
+}
+
+// Drain waits for Run to return after its context was cancelled. Jobs still
+// running when ctx expires are interrupted and put back into the queue for
+// another replica, without counting the interrupted attempt.
+func (pool *WorkerPool) Drain(ctx context.Context) error {
+	select {
+	case <-pool.done:
+		return nil
+	case <-ctx.Done():
+		pool.abort()
+		<-pool.done
+		return ctx.Err()
+	}
+}
+
+// Healthy returns an error when no worker went round its loop for longer
+// than a job may take, which means the workers are stuck or not running.
+func (pool *WorkerPool) Healthy() error {
+	heartbeat := atomic.LoadInt64(&pool.heartbeat)
+	if heartbeat == 0 {
+		return fmt.Errorf("worker pool not running")
+	}
+	if since := time.Since(time.Unix(0, heartbeat)); since > pool.lease+2*pool.pollInterval {
+		return fmt.Errorf("no worker made progress for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+func (pool *WorkerPool) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		atomic.StoreInt64(&pool.heartbeat, time.Now().UnixNano())
+		job, err := claimJob(ctx, pool.db, pool.lease, pool.retry)
+		if err == nil {
+			pool.process(job)
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) && ctx.Err() == nil {
+			level.Error(pool.logger).Log("context", "claim job", "msg", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(pool.pollInterval):
+		}
+	}
+}
+
+func (pool *WorkerPool) process(job ProcessingJob) {
+	logger := log.With(pool.logger, "request-id", job.RequestId, "job", job.Id, "photo", job.IdPhoto, "variant", job.Variant)
+	// The job times out before its lease expires, leaving time to record its
+	// outcome before another worker may claim it.
+	ctx, cancel := context.WithTimeout(withRequestId(pool.jobs, job.RequestId), pool.lease-pool.lease/10)
+	defer cancel()
+	ctx, span := startSpan(withTraceParent(ctx, job.TraceParent), job.Kind+"Image",
+		label.Int64("photo.id", int64(job.IdPhoto)),
+		label.String("variant", job.Variant),
+		label.Int("job.attempt", job.Attempts),
+	)
+
+	var photo Photo
+	query := pool.db.WithContext(ctx)
+	if job.Kind == JobKindDelete {
+		query = query.Unscoped()
+	}
+	err := query.First(&photo, job.IdPhoto).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && job.Kind != JobKindDelete {
+		err = fmt.Errorf("photo %d: %w", job.IdPhoto, errPhotoDeleted)
+	}
+	if err == nil {
+		switch job.Kind {
+		case JobKindAnalyze:
+			err = pool.analyzeImage(ctx, logger, photo)
+		case JobKindDelete:
+			err = pool.deletePhoto(ctx, logger, photo, job)
+		default:
+			err = pool.resizeImage(ctx, logger, photo, job)
+		}
+	}
+	endSpan(span, err)
+	if pool.jobs.Err() != nil {
+		level.Warn(logger).Log("msg", "Processing job interrupted by shutdown, requeueing.", "attempt", job.Attempts)
+		logRecordError(logger, "release job", releaseJob(pool.db, job))
+		return
+	}
+	if errors.Is(err, errPhotoBusy) {
+		level.Info(logger).Log("msg", "Processing job postponed.", "err", err)
+		logRecordError(logger, "postpone job", postponeJob(pool.db, job, pool.retry.Backoff))
+		return
+	}
+	if err != nil {
+		level.Error(logger).Log("msg", "Processing job failed.", "attempt", job.Attempts, "err", err)
+	}
+	logRecordError(logger, "finish job", finishJob(pool.db, job, err, pool.retry))
+}
+
+// logRecordError logs a failure to record a job's outcome. Outcomes of jobs
+// that lost their lease are dropped, the worker that claimed them next
+// records its own.
+func logRecordError(logger log.Logger, what string, err error) {
+	switch {
+	case errors.Is(err, errLeaseLost):
+		level.Warn(logger).Log("context", what, "msg", err)
+	case err != nil:
+		level.Error(logger).Log("context", what, "msg", err)
+	}
+}
+
+// fetchOriginal downloads and validates the original of a photo. This is
+// done before any backend sees it, also when third-party backends fetch it
+// again by URL. The pixels decoded for validation are kept for the local
+// backend and the analysis.
+func (pool *WorkerPool) fetchOriginal(ctx context.Context, photo Photo) (ResizeSource, error) {
+	data, err := pool.fetcher.Fetch(ctx, photo.UrlOriginal)
+	var img image.Image
+	if err == nil {
+		img, err = validateImage(data, pool.images.MaxPixels)
+	}
+	if err != nil {
+		return ResizeSource{}, fmt.Errorf("original %q: %w", photo.UrlOriginal, err)
+	}
+	return ResizeSource{Url: photo.UrlOriginal, Data: data, Orientation: exifOrientation(data), Image: img}, nil
+}
+
+// analyzeImage computes the placeholders and perceptual hash of a photo's
+// original and stores them on the photo.
+func (pool *WorkerPool) analyzeImage(ctx context.Context, logger log.Logger, photo Photo) error {
+	source, err := pool.fetchOriginal(ctx, photo)
+	if err != nil {
+		return err
+	}
+	analysis, err := analyzeImage(source.Image, source.Orientation)
+	if err != nil {
+		return err
+	}
+	bands := splitHash(analysis.PerceptualHash)
+	err = pool.db.WithContext(ctx).Model(&photo).Updates(map[string]interface{}{
+		"blur_hash":       analysis.BlurHash,
+		"placeholder":     analysis.Placeholder,
+		"perceptual_hash": int64(analysis.PerceptualHash),
+		"hash_band0":      bands[0],
+		"hash_band1":      bands[1],
+		"hash_band2":      bands[2],
+		"hash_band3":      bands[3],
+	}).Error
+	if err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "Photo analyzed.", "blurhash", analysis.BlurHash, "phash", fmt.Sprintf("%016x", analysis.PerceptualHash))
+	return nil
+}
+
+// deletePhoto removes the objects of a deleted photo from storage and clears
+// its URLs. It waits for jobs of the photo that are still running, as they may
+// store another variant, by failing with errPhotoBusy. Every attempt picks up
+// where the last one failed.
+func (pool *WorkerPool) deletePhoto(ctx context.Context, logger log.Logger, photo Photo, job ProcessingJob) error {
+	db := pool.db.WithContext(ctx)
+	running, err := runningJobs(db, photo.IdPhoto, job.Id)
+	if err != nil {
+		return err
+	}
+	if running > 0 {
+		return fmt.Errorf("photo %d: %d jobs: %w", photo.IdPhoto, running, errPhotoBusy)
+	}
+
+	var variants []PhotoVariant
+	if err := db.Where("id_photo = ?", photo.IdPhoto).Order("id").Find(&variants).Error; err != nil {
+		return err
+	}
+	for _, variant := range variants {
+		deleted, err := deleteVariant(ctx, pool.db, pool.store, variant)
+		if err != nil {
+			return fmt.Errorf("variant %q: %w", variant.Name, err)
+		}
+		if deleted {
+			if err := audit(db, photo, AuditObjectDeleted, variant.StorageKey, job.RequestId); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Photos resized before variants were recorded only have the legacy
+	// columns. Content addressed objects were handled above, as they may be
+	// shared.
+	urls := []string{photo.UrlSmall, photo.UrlMedium, photo.UrlLarge}
+	if job.DeleteOriginal {
+		urls = append(urls, photo.UrlOriginal)
+	}
+	for _, url := range urls {
+		key, ok := pool.urls.Key(url)
+		if !ok || strings.HasPrefix(key, variantPrefix) {
+			continue
+		}
+		err := pool.store.Delete(ctx, key)
+		if errors.Is(err, ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("deleting %s: %w", key, err)
+		}
+		if err := audit(db, photo, AuditObjectDeleted, key, job.RequestId); err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{"url_small": "", "url_medium": "", "url_large": ""}
+	if job.DeleteOriginal {
+		if _, ok := pool.urls.Key(photo.UrlOriginal); ok || photo.UrlOriginal == "" {
+			updates["url_original"] = ""
+		} else {
+			// Originals outside the bucket are not ours to delete, the
+			// trail tells where they are.
+			if err := audit(db, photo, AuditOriginalKept, photo.UrlOriginal, job.RequestId); err != nil {
+				return err
+			}
+		}
+	}
+	if err := db.Unscoped().Model(&photo).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := audit(db, photo, AuditCompleted, "", job.RequestId); err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "Photo deleted from storage.", "variants", len(variants))
+	return nil
+}
+
+func (pool *WorkerPool) resizeImage(ctx context.Context, logger log.Logger, photo Photo, job ProcessingJob) error {
+	logContext, _ := json.Marshal(photo)
+	spec := ResizeSpec{
+		Width:   job.Width,
+		Height:  job.Height,
+		Fit:     job.Fit,
+		Format:  job.Format,
+		Quality: job.Quality,
+	}
+	source, err := pool.fetchOriginal(ctx, photo)
+	if err != nil {
+		return err
+	}
+
+	lastErr := ErrUnsupportedSpec
+	for i, resizer := range pool.resizers {
+		if i > 0 {
+			level.Warn(logger).Log("context", logContext, "msg", fmt.Sprintf("Image resizing FALLBACK to %s.", resizer.Name()))
+			pool.metrics.Fallbacks.With("backend", resizer.Name()).Add(1)
+		}
+		begin := time.Now()
+		variant, err := pool.resize(ctx, resizer, source, spec)
+		pool.metrics.ResizeLatency.With("backend", resizer.Name()).Observe(time.Since(begin).Seconds())
+		pool.metrics.ResizeCount.With("backend", resizer.Name(), "outcome", outcome(err)).Add(1)
+		if errors.Is(err, ErrUnsupportedSpec) {
+			continue
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", resizer.Name(), err)
+			level.Error(logger).Log("context", resizer.Name(), "msg", err)
+			continue
+		}
+
+		variant.IdPhoto = photo.IdPhoto
+		variant.Name = job.Variant
+		saveCtx, span := startSpan(ctx, "saveVariant")
+		err = saveVariant(pool.db.WithContext(saveCtx), photo, variant, job.Custom)
+		endSpan(span, err)
+		if err != nil {
+			pool.releaseObject(logger, variant.StorageKey)
+			return err
+		}
+		level.Info(logger).Log("context", logContext, "backend", resizer.Name(), "msg", "Resized photo successfully uploaded.")
+		return nil
+	}
+	return fmt.Errorf("all resize backends failed, last error: %w", lastErr)
+}
+
+// resize runs a single backend of the chain, strips the metadata off its
+// output and uploads it to storage, unless an identical variant was uploaded
+// before.
+func (pool *WorkerPool) resize(ctx context.Context, resizer Resizer, source ResizeSource, spec ResizeSpec) (variant PhotoVariant, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
+	defer cancel()
+	ctx, span := startSpan(ctx, "resize", label.String("backend", resizer.Name()))
+	defer func() { endSpan(span, err) }()
+
+	result, err := resizer.Resize(ctx, source, spec)
+	if err != nil {
+		return PhotoVariant{}, err
+	}
+	data, err := sanitizeImage(result.Data, source.Data, pool.images.KeepICC)
+	if err != nil {
+		return PhotoVariant{}, fmt.Errorf("stripping metadata: %w", err)
+	}
+	result.Data = data
+	// Backends' content types are not trusted, the stored one has to match
+	// the data for browsers to pick the right <picture> source.
+	if sniffed := http.DetectContentType(data); strings.HasPrefix(sniffed, "image/") {
+		result.ContentType = sniffed
+	}
+	variant = PhotoVariant{
+		Width:       result.Width,
+		Height:      result.Height,
+		Format:      formatOf(result.ContentType, spec.Format),
+		ContentType: result.ContentType,
+		Backend:     resizer.Name(),
+	}
+	if variant.Width == 0 {
+		if config, _, err := image.DecodeConfig(bytes.NewReader(result.Data)); err == nil {
+			variant.Width, variant.Height = config.Width, config.Height
+		}
+	}
+	hash := sha256.Sum256(result.Data)
+	variant.ContentHash = hex.EncodeToString(hash[:])
+	variant.Size = int64(len(result.Data))
+	variant.StorageKey = variantKey(result.Data, spec, variant.Format)
+	variant.Url = pool.store.URL(variant.StorageKey)
+	// The object is referenced before looking for it, so neither deleted
+	// variants nor the garbage collector can remove an existing object
+	// between finding it and saving the variant. The reference passes to the
+	// variant once it is saved.
+	if err := referenceObject(pool.db.WithContext(ctx), variant.StorageKey, variant.Size); err != nil {
+		return PhotoVariant{}, err
+	}
+	// Keys are derived from the content, an existing object already holds
+	// exactly these bytes.
+	if _, err := pool.store.Stat(ctx, variant.StorageKey); err == nil {
+		pool.metrics.SkippedUploads.Add(1)
+		return variant, nil
+	}
+	begin := time.Now()
+	putCtx, putSpan := startSpan(ctx, "ObjectStore.Put",
+		label.String("storage.key", variant.StorageKey),
+		label.Int64("storage.size", variant.Size),
+	)
+	err = pool.store.Put(putCtx, variant.StorageKey, bytes.NewReader(result.Data), PutOptions{
+		ContentType:  variant.ContentType,
+		CacheControl: pool.images.CacheControl,
+		Size:         variant.Size,
+	})
+	endSpan(putSpan, err)
+	if err != nil {
+		pool.releaseObject(pool.logger, variant.StorageKey)
+		return PhotoVariant{}, fmt.Errorf("Storage upload: %w", err)
+	}
+	pool.metrics.UploadLatency.Observe(time.Since(begin).Seconds())
+	pool.metrics.UploadedBytes.Add(float64(variant.Size))
+	return variant, nil
+}
+
+// releaseObject drops the reference taken on an object for a variant that
+// was not saved. A reference that can not be dropped only keeps the object
+// from being collected.
+func (pool *WorkerPool) releaseObject(logger log.Logger, key string) {
+	if err := releaseObject(pool.db, key); err != nil {
+		level.Error(logger).Log("context", "release object", "key", key, "msg", err)
+	}
+}
+
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrUnsupportedSpec):
+		return "unsupported"
+	default:
+		return "error"
+	}
+}